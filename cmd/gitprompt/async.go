@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/comfortablynick/gitprompt/gitstatus"
+)
+
+const (
+	// asyncRefreshEnv is set in the environment of the background
+	// process started by --async to refresh the cache
+	asyncRefreshEnv = "GITPROMPT_ASYNC_REFRESH"
+
+	// refreshLockAge is how long a refresh lock is honored; an older lock
+	// was left by a refresh that died
+	refreshLockAge = time.Minute
+)
+
+// runAsync returns the cached status for dir without waiting for git.
+// If the entry is stale, a background refresh is started and the entry is
+// marked Stale. With nothing cached, only what can be read without
+// running git is returned. A nil result means status must be collected
+// synchronously, ex: dir is not in a repo.
+func runAsync(dir string, opts gitstatus.Options) *RepoInfo {
+	cache, err := openCache(dir, opts)
+	if err != nil {
+		log.Printf("Cannot open status cache: %s", err)
+		return nil
+	}
+	st, fresh := cache.load(options.CacheMaxAge)
+	if fresh {
+		log.Printf("Using cached status from %s", cache.path)
+		st.WorkingDir = cwd
+		return &RepoInfo{Status: st}
+	}
+
+	if err := startRefresh(cache); err != nil {
+		log.Printf("Error starting background refresh: %s", err)
+	}
+	if st == nil {
+		st, err = gitstatus.Collect(context.Background(), cwd, gitstatus.Options{
+			NoGitTag:   opts.NoGitTag,
+			SkipStatus: true,
+		})
+		if err != nil {
+			return nil
+		}
+	}
+	st.WorkingDir = cwd
+	return &RepoInfo{Status: st, Stale: true}
+}
+
+// startRefresh runs gitprompt again with the same arguments in a new
+// session so it outlives the prompt, unless a refresh is already running
+func startRefresh(cache *statusCache) error {
+	lock := cache.path + ".lock"
+	if fi, err := os.Stat(lock); err == nil {
+		if time.Since(fi.ModTime()) < refreshLockAge {
+			log.Printf("Refresh already running")
+			return nil
+		}
+		os.Remove(lock)
+	}
+	if err := os.MkdirAll(filepath.Dir(lock), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	f.Close()
+
+	self, err := os.Executable()
+	if err != nil {
+		os.Remove(lock)
+		return err
+	}
+	cmd := exec.Command(self, os.Args[1:]...) // #nosec
+	cmd.Env = append(os.Environ(), asyncRefreshEnv+"=1")
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		os.Remove(lock)
+		return err
+	}
+	log.Printf("Started background refresh, pid %d", cmd.Process.Pid)
+	return cmd.Process.Release()
+}
+
+// refreshCache collects status and writes it to the cache, then signals
+// the shell given by --notify so it can redraw the prompt. It runs in the
+// background process started by startRefresh.
+func refreshCache() {
+	opts := collectOptions()
+	dir, err := filepath.Abs(cwd)
+	if err != nil {
+		dir = cwd
+	}
+	cache, err := openCache(dir, opts)
+	if err != nil {
+		log.Printf("Cannot open status cache: %s", err)
+		return
+	}
+	defer os.Remove(cache.path + ".lock")
+
+	opts.Logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	st, err := gitstatus.Collect(context.Background(), cwd, opts)
+	if err != nil {
+		log.Printf("Git status error: %s", err)
+		return
+	}
+	if err := cache.store(st); err != nil {
+		log.Printf("Error writing status cache: %s", err)
+		return
+	}
+	if options.Notify > 0 {
+		if err := notifyShell(options.Notify); err != nil {
+			log.Printf("Error signaling shell %d: %s", options.Notify, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/comfortablynick/gitprompt/gitstatus"
+)
+
+func TestRunAsync(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gitprompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	oldCache, oldCwd, oldMaxAge := os.Getenv("XDG_CACHE_HOME"), cwd, options.CacheMaxAge
+	defer func() {
+		os.Setenv("XDG_CACHE_HOME", oldCache)
+		cwd, options.CacheMaxAge = oldCwd, oldMaxAge
+	}()
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(tmp, "cache"))
+
+	repo := filepath.Join(tmp, "repo")
+	cwd = repo
+	if err := os.MkdirAll(filepath.Join(repo, ".git", "refs", "heads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/feature\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := gitstatus.Options{}
+	cache, err := openCache(repo, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A held lock stops runAsync from starting a real refresh
+	if err := os.MkdirAll(filepath.Dir(cache.path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cache.path+".lock", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing cached: branch is read from HEAD without running git
+	options.CacheMaxAge = time.Minute
+	if ri := runAsync(repo, opts); ri == nil || !ri.Stale || ri.Branch != "feature" {
+		t.Errorf("expected stale status read from HEAD, got %+v", ri)
+	}
+
+	if err := cache.store(&gitstatus.Status{Branch: "feature", Untracked: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if ri := runAsync(repo, opts); ri == nil || ri.Stale || ri.Untracked != 3 {
+		t.Errorf("expected fresh cached status, got %+v", ri)
+	}
+
+	options.CacheMaxAge = 0
+	if ri := runAsync(repo, opts); ri == nil || !ri.Stale || ri.Untracked != 3 {
+		t.Errorf("expected stale cached status, got %+v", ri)
+	}
+
+	if ri := runAsync(tmp, opts); ri != nil {
+		t.Errorf("expected nil outside a repo, got %+v", ri)
+	}
+}
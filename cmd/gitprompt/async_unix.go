@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts cmd in its own session so it is not killed with the
+// shell's process group when the prompt is interrupted
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// notifyShell sends SIGUSR1 to pid, ex: for a zsh TRAPUSR1 that
+// runs `zle reset-prompt`
+func notifyShell(pid int) error {
+	return syscall.Kill(pid, syscall.SIGUSR1)
+}
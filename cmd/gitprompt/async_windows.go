@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// detach is a no-op; a started process already outlives its parent
+func detach(cmd *exec.Cmd) {}
+
+// notifyShell is not supported as there is no SIGUSR1
+func notifyShell(pid int) error {
+	return errors.New("signaling the shell is not supported on windows")
+}
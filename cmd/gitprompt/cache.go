@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha1" // #nosec: used only to name cache files
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/comfortablynick/gitprompt/gitstatus"
+)
+
+// cacheVersion is bumped whenever the cached Status layout changes
+const cacheVersion = 1
+
+// cacheEntry is the on-disk form of a cached status
+type cacheEntry struct {
+	Version int               `json:"version"`
+	Stamp   map[string]int64  `json:"stamp"`
+	Created time.Time         `json:"created"`
+	Status  *gitstatus.Status `json:"status"`
+}
+
+// statusCache is the cache file for one repo and set of options
+type statusCache struct {
+	path  string
+	stamp map[string]int64 // mtimes of the repo's git files when opened
+}
+
+// openCache finds the cache file for the repo containing dir under
+// $XDG_CACHE_HOME/gitprompt and records the current state of its index,
+// HEAD and refs. Work tree changes are not detected until the entry
+// reaches its max age.
+func openCache(dir string, opts gitstatus.Options) (*statusCache, error) {
+	repo, err := gitstatus.OpenRepo(dir)
+	if err != nil {
+		return nil, err
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	h := sha1.New() // #nosec
+	h.Write([]byte(repo.GitDir + "\x00" + repo.WorkTree + "\x00" + optionsKey(opts)))
+	return &statusCache{
+		path:  filepath.Join(base, "gitprompt", hex.EncodeToString(h.Sum(nil))+".json"),
+		stamp: repoStamp(repo),
+	}, nil
+}
+
+// repoStamp returns the mtimes of the files git changes when the index,
+// HEAD, refs or stash change. Missing files are recorded as 0.
+func repoStamp(repo *gitstatus.Repo) map[string]int64 {
+	stamp := make(map[string]int64)
+	for name, path := range map[string]string{
+		"index":       filepath.Join(repo.GitDir, "index"),
+		"HEAD":        filepath.Join(repo.GitDir, "HEAD"),
+		"packed-refs": filepath.Join(repo.CommonDir, "packed-refs"),
+		"stash":       filepath.Join(repo.CommonDir, "logs", "refs", "stash"),
+	} {
+		if fi, err := os.Stat(path); err == nil {
+			stamp[name] = fi.ModTime().UnixNano()
+		}
+	}
+	// A ref update replaces the file, so the newest mtime under refs/
+	// changes even if the number of refs does not
+	filepath.Walk(filepath.Join(repo.CommonDir, "refs"), func(path string, fi os.FileInfo, err error) error { // #nosec
+		if err == nil && fi.ModTime().UnixNano() > stamp["refs"] {
+			stamp["refs"] = fi.ModTime().UnixNano()
+		}
+		return nil
+	})
+	return stamp
+}
+
+// load returns the cached status, and whether it is still fresh: the
+// repo is unchanged and the entry is younger than maxAge
+func (c *statusCache) load(maxAge time.Duration) (*gitstatus.Status, bool) {
+	b, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return nil, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil || e.Version != cacheVersion || e.Status == nil {
+		return nil, false
+	}
+	fresh := time.Since(e.Created) < maxAge && len(e.Stamp) == len(c.stamp)
+	for name, mtime := range c.stamp {
+		fresh = fresh && e.Stamp[name] == mtime
+	}
+	return e.Status, fresh
+}
+
+// store writes st to the cache, replacing the file atomically so
+// concurrent prompts never read a partial entry
+func (c *statusCache) store(st *gitstatus.Status) error {
+	b, err := json.Marshal(cacheEntry{
+		Version: cacheVersion,
+		Stamp:   c.stamp,
+		Created: time.Now(),
+		Status:  st,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/comfortablynick/gitprompt/gitstatus"
+)
+
+func TestStatusCache(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gitprompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	oldCache := os.Getenv("XDG_CACHE_HOME")
+	defer os.Setenv("XDG_CACHE_HOME", oldCache)
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(tmp, "cache"))
+
+	repo := filepath.Join(tmp, "repo")
+	head := filepath.Join(repo, ".git", "HEAD")
+	if err := os.MkdirAll(filepath.Join(repo, ".git", "refs", "heads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(head, []byte("ref: refs/heads/master\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := gitstatus.Options{Stash: true}
+	cache, err := openCache(repo, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, fresh := cache.load(time.Minute); fresh {
+		t.Fatal("expected empty cache")
+	}
+	if err := cache.store(&gitstatus.Status{Branch: "master", Untracked: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, _ = openCache(repo, opts)
+	if st, fresh := cache.load(time.Minute); !fresh || st.Branch != "master" || st.Untracked != 2 {
+		t.Errorf("expected fresh cached status, got %+v (fresh: %v)", st, fresh)
+	}
+	if _, fresh := cache.load(0); fresh {
+		t.Error("expected entry older than max age to be stale")
+	}
+	if other, _ := openCache(repo, gitstatus.Options{}); other.path == cache.path {
+		t.Error("expected different options to use a different cache entry")
+	}
+
+	// Moving HEAD invalidates the entry, but it can still be read
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(head, later, later); err != nil {
+		t.Fatal(err)
+	}
+	cache, _ = openCache(repo, opts)
+	if st, fresh := cache.load(time.Minute); fresh || st == nil {
+		t.Errorf("expected stale cached status after HEAD changed, got %+v (fresh: %v)", st, fresh)
+	}
+}
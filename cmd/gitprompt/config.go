@@ -0,0 +1,335 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/comfortablynick/gitprompt/gitstatus"
+)
+
+// configEnv names a config file to use instead of the default
+const configEnv = "GITPROMPT_CONFIG"
+
+// settingFlags maps each top-level config key to the flag it sets.
+// Flags given on the command line override the config file.
+var settingFlags = []struct{ key, flag string }{
+	{"format", "f"},
+	{"output", "o"},
+	{"shell", "shell"},
+	{"timeout", "t"},
+	{"no_color", "n"},
+	{"no_tag", "no-tag"},
+	{"backend", "backend"},
+	{"socket", "socket"},
+	{"cache", "cache"},
+	{"cache_max_age", "cache-max-age"},
+	{"async", "async"},
+	{"submodules", "submodules"},
+	{"theme", "theme"},
+	{"glyph_set", "glyphs"},
+	{"max_width", "max-width"},
+}
+
+// configSection holds the settings of the top level of the config file,
+// or of a single profile
+type configSection struct {
+	settings map[string]interface{} // by config key
+	glyphs   map[string]string
+	colors   map[string]string
+}
+
+// config is a parsed config file, ex:
+//
+//	format = "%g %b%a %m%u"
+//	timeout = 200
+//
+//	[glyphs]
+//	branch = "git:"
+//
+//	[colors]
+//	branch_clean = "green,bold"
+//
+//	[profiles.work]
+//	backend = "native"
+type config struct {
+	configSection
+	profiles map[string]*configSection
+}
+
+// configPath returns the config file named by $GITPROMPT_CONFIG, or
+// $XDG_CONFIG_HOME/gitprompt/config.toml. The default file is optional;
+// one named in the environment must exist.
+func configPath() (path string, required bool) {
+	if path := os.Getenv(configEnv); path != "" {
+		return path, true
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gitprompt", "config.toml"), false
+}
+
+// loadConfig reads the config file and applies it, with the named
+// profile if any, to the flags in fs that were not set on the command line
+func loadConfig(fs *flag.FlagSet, profile string) error {
+	path, required := configPath()
+	cfg, err := readConfig(path)
+	if os.IsNotExist(err) && !required {
+		cfg, err = &config{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	return cfg.apply(fs, profile)
+}
+
+// readConfig parses the config file at path
+func readConfig(path string) (*config, error) {
+	var raw map[string]interface{}
+	if _, err := toml.DecodeFile(path, &raw); err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cfg := &config{profiles: make(map[string]*configSection)}
+	if profiles, ok := raw["profiles"]; ok {
+		delete(raw, "profiles")
+		tables, ok := profiles.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: profiles must be a table", path)
+		}
+		for name, table := range tables {
+			t, ok := table.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: profile `%s' must be a table", path, name)
+			}
+			section, err := parseSection(t)
+			if err != nil {
+				return nil, fmt.Errorf("%s: profile `%s': %w", path, name, err)
+			}
+			cfg.profiles[name] = section
+		}
+	}
+	section, err := parseSection(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.configSection = *section
+	return cfg, nil
+}
+
+// parseSection checks the keys and values of a single table
+func parseSection(raw map[string]interface{}) (*configSection, error) {
+	s := &configSection{
+		settings: make(map[string]interface{}),
+		glyphs:   make(map[string]string),
+		colors:   make(map[string]string),
+	}
+	for key, value := range raw {
+		switch key {
+		case "glyphs":
+			if err := parseStrings(key, value, s.glyphs, func(name, _ string) error {
+				if _, ok := glyphSets["unicode"][name]; !ok {
+					return fmt.Errorf("unknown glyph `%s'", name)
+				}
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		case "colors":
+			if err := parseStrings(key, value, s.colors, func(name, spec string) error {
+				if _, ok := themes["default"][name]; !ok {
+					return fmt.Errorf("unknown color `%s'", name)
+				}
+				_, err := parseColor(spec)
+				return err
+			}); err != nil {
+				return nil, err
+			}
+		default:
+			if err := checkSetting(key, value); err != nil {
+				return nil, err
+			}
+			s.settings[key] = value
+		}
+	}
+	return s, nil
+}
+
+// parseStrings copies the table value into out, checking each entry
+func parseStrings(key string, value interface{}, out map[string]string, check func(name, value string) error) error {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s must be a table", key)
+	}
+	for name, v := range table {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s.%s must be a string", key, name)
+		}
+		if err := check(name, s); err != nil {
+			return err
+		}
+		out[name] = s
+	}
+	return nil
+}
+
+// settingFlag returns the flag set by a config key, or "" if unknown
+func settingFlag(key string) string {
+	for _, s := range settingFlags {
+		if s.key == key {
+			return s.flag
+		}
+	}
+	return ""
+}
+
+// apply sets flags, glyphs and colors from the top level of the config
+// and then the profile. Flags already set in fs are left alone.
+func (c *config) apply(fs *flag.FlagSet, profile string) error {
+	sections := []*configSection{&c.configSection}
+	if profile != "" {
+		p, ok := c.profiles[profile]
+		if !ok {
+			return fmt.Errorf("unknown profile `%s'", profile)
+		}
+		sections = append(sections, p)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for _, s := range sections {
+		for key, value := range s.settings {
+			name := settingFlag(key)
+			if set[name] {
+				continue
+			}
+			if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	// Glyphs and colors from the config file override the glyph set
+	// and theme
+	if err := useGlyphs(fs.Lookup("glyphs").Value.String()); err != nil {
+		return err
+	}
+	if err := useTheme(fs.Lookup("theme").Value.String()); err != nil {
+		return err
+	}
+	for _, s := range sections {
+		for name, glyph := range s.glyphs {
+			glyphs[name] = glyph
+		}
+		for name, spec := range s.colors {
+			colors[name] = spec
+		}
+	}
+	if stale := fs.Lookup("stale-glyph").Value.String(); stale != "" {
+		glyphs["stale"] = stale
+	}
+	return nil
+}
+
+// checkSetting checks that a config value has the type of its flag
+func checkSetting(key string, value interface{}) error {
+	f := flag.Lookup(settingFlag(key))
+	if f == nil {
+		return fmt.Errorf("unknown key `%s'", key)
+	}
+	var ok bool
+	switch f.Value.(flag.Getter).Get().(type) {
+	case bool:
+		_, ok = value.(bool)
+	case int:
+		_, ok = value.(int64)
+	case string, time.Duration:
+		_, ok = value.(string)
+	}
+	if !ok {
+		return fmt.Errorf("%s: invalid value %v", key, value)
+	}
+	return nil
+}
+
+// dumpConfig writes the effective config, after applying the config
+// file, profile and flags, in config file form
+func dumpConfig(w io.Writer, fs *flag.FlagSet) error {
+	out := make(map[string]interface{})
+	for _, s := range settingFlags {
+		value := fs.Lookup(s.flag).Value.(flag.Getter).Get()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		out[s.key] = value
+	}
+	out["glyphs"] = map[string]string(glyphs)
+	out["colors"] = map[string]string(colors)
+	enc := toml.NewEncoder(w)
+	enc.Indent = ""
+	return enc.Encode(out)
+}
+
+// loadRepoConfig applies gitprompt.* keys from the config of the repo
+// containing dir over the global options, except for a format given on
+// the command line, ex:
+//
+//	git config gitprompt.showUntracked false
+func loadRepoConfig(dir string) error {
+	repo, err := gitstatus.OpenRepo(dir)
+	if err != nil {
+		return nil
+	}
+	config, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	if format, ok := config["gitprompt.format"]; ok && !argFlags["f"] {
+		options.Format = format
+	}
+	for key, hide := range map[string]*bool{
+		"gitprompt.showuntracked": &options.HideUntracked,
+		"gitprompt.showdiff":      &options.HideDiff,
+	} {
+		if v, ok := config[key]; ok {
+			show, err := configBool(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			*hide = !show
+		}
+	}
+	if v, ok := config["gitprompt.disable"]; ok {
+		if options.Disable, err = configBool(v); err != nil {
+			return fmt.Errorf("gitprompt.disable: %w", err)
+		}
+	}
+	return nil
+}
+
+// configBool parses a git config boolean; see git-config(1)
+func configBool(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean `%s'", v)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+format = "%b %m"
+timeout = 200
+no_tag = true
+
+[glyphs]
+modified = "*"
+stale = "~"
+
+[colors]
+branch_clean = "black bg:cyan"
+
+[profiles.work]
+backend = "native"
+format = "[%b]"
+glyph_set = "ascii"
+`
+
+// testFlags returns a copy of the command line flags sharing their
+// values, so tests can tell which flags were set
+func testFlags(t *testing.T, args ...string) *flag.FlagSet {
+	t.Helper()
+	fs := flag.NewFlagSet("gitprompt", flag.ContinueOnError)
+	flag.VisitAll(func(f *flag.Flag) { fs.Var(f.Value, f.Name, f.Usage) })
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+// writeConfig points $GITPROMPT_CONFIG at a file holding s, returning
+// a func restoring the environment, options, glyphs and colors
+func writeConfig(t *testing.T, s string) func() {
+	t.Helper()
+	tmp, err := ioutil.TempDir("", "gitprompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(tmp, "config.toml")
+	if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldEnv, oldOptions := os.Getenv(configEnv), options
+	oldGlyphs, oldColors := glyphs, colors
+	os.Setenv(configEnv, path)
+	return func() {
+		os.RemoveAll(tmp)
+		os.Setenv(configEnv, oldEnv)
+		options = oldOptions
+		glyphs, colors = oldGlyphs, oldColors
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	defer writeConfig(t, testConfig)()
+
+	if err := loadConfig(testFlags(t, "-t", "5", "-stale-glyph", "!"), "work"); err != nil {
+		t.Fatal(err)
+	}
+	if options.Format != "[%b]" || options.Backend != "native" || !options.NoGitTag {
+		t.Errorf("config and profile not applied: %+v", options)
+	}
+	if options.Timeout != 5 || glyphs["stale"] != "!" {
+		t.Errorf("flags should override config: %+v", options)
+	}
+	if glyphs["modified"] != "*" || glyphs["ahead"] != "^" || colors["branch_clean"] != "black bg:cyan" {
+		t.Errorf("glyphs or colors not applied: %q %q", glyphs["modified"], colors["branch_clean"])
+	}
+
+	var buf bytes.Buffer
+	if err := dumpConfig(&buf, testFlags(t)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`format = "[%b]"`, "timeout = 5", `modified = "*"`, `cache_max_age = "10s"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("dump missing %s:\n%s", want, buf.String())
+		}
+	}
+
+	if err := loadConfig(testFlags(t), "home"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, s := range []string{
+		`color = "red"`,
+		`timeout = "fast"`,
+		`no_tag = 1`,
+		"[glyphs]\nbranchy = \"x\"",
+		"[colors]\nbranch_clean = \"chartreuse\"",
+		"[colors]\nbranch_clean = \"bg:bold\"",
+		"[profiles.work]\nshell = 1",
+		`glyph_set = "emoji"`,
+		"format = ",
+	} {
+		restore := writeConfig(t, s)
+		if err := loadConfig(testFlags(t), ""); err == nil {
+			t.Errorf("expected error loading config %q", s)
+		}
+		restore()
+	}
+}
+
+func TestLoadRepoConfig(t *testing.T) {
+	defer writeConfig(t, "")()
+
+	repo := filepath.Join(filepath.Dir(os.Getenv(configEnv)), "repo")
+	if err := os.MkdirAll(filepath.Join(repo, ".git", "refs", "heads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/master\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(repo, ".git", "config")
+	if err := ioutil.WriteFile(config, []byte("[gitprompt]\n\tformat = %b\n\tshowUntracked = false\n\tshowDiff = yes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options.Format, options.HideDiff = defaultFormat, true
+	if err := loadRepoConfig(repo); err != nil {
+		t.Fatal(err)
+	}
+	if options.Format != "%b" || !options.HideUntracked || options.HideDiff || options.Disable {
+		t.Errorf("repo config not applied: %+v", options)
+	}
+	if opts := collectOptions(); !opts.NoUntracked {
+		t.Errorf("expected untracked files to be skipped: %+v", opts)
+	}
+
+	// -f and -o presets on the command line override the repo format
+	defer func() { delete(argFlags, "f") }()
+	argFlags["f"] = true
+	options.Format = "%c"
+	if err := loadRepoConfig(repo); err != nil || options.Format != "%c" {
+		t.Errorf("expected format from the command line, got %v %q", err, options.Format)
+	}
+
+	if err := ioutil.WriteFile(config, []byte("[gitprompt]\n\tdisable\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadRepoConfig(repo); err != nil || !options.Disable {
+		t.Errorf("expected prompt to be disabled, got %v %+v", err, options)
+	}
+
+	if err := ioutil.WriteFile(config, []byte("[gitprompt]\n\tdisable = maybe\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadRepoConfig(repo); err == nil {
+		t.Error("expected error for invalid boolean")
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/comfortablynick/gitprompt/gitstatus"
+)
+
+const (
+	// daemonDialTimeout bounds how long a prompt waits to connect
+	// before collecting status itself
+	daemonDialTimeout = 20 * time.Millisecond
+
+	// daemonIdleRepo is how long a repo stays cached and watched
+	// after its last query
+	daemonIdleRepo = 30 * time.Minute
+)
+
+// daemonRequest is sent by a client for each prompt
+type daemonRequest struct {
+	Dir     string            `json:"dir"`
+	Timeout int               `json:"timeout"` // milliseconds, 0 for none
+	Options gitstatus.Options `json:"options"`
+}
+
+// daemonResponse is the daemon's reply to a single request
+type daemonResponse struct {
+	Status *gitstatus.Status `json:"status,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// defaultSocketPath returns the daemon socket in $XDG_RUNTIME_DIR,
+// or in a per-user dir in the temp dir, which the daemon creates
+// with mode 0700
+func defaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "gitprompt.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gitprompt-%d", os.Getuid()), "daemon.sock")
+}
+
+// queryDaemon asks a running daemon for the status of dir. An error
+// means the caller should collect status itself.
+func queryDaemon(ctx context.Context, socket string, req daemonRequest) (*gitstatus.Status, error) {
+	if err := checkSocket(socket); err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, daemonDialTimeout)
+	conn, err := d.DialContext(dialCtx, "unix", socket)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp daemonResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	if resp.Status == nil {
+		return nil, errors.New("empty response from daemon")
+	}
+	return resp.Status, nil
+}
+
+// daemon caches status per repo and options, dropping a repo's
+// cached status whenever its work tree or git dir changes
+type daemon struct {
+	log     *log.Logger
+	watcher *watcher
+
+	mu    sync.Mutex
+	repos map[string]*cachedRepo // by work tree
+}
+
+// cachedRepo holds the cached status of a single repo
+type cachedRepo struct {
+	gen      uint64 // incremented on every change
+	lastUsed time.Time
+	entries  map[string]*gitstatus.Status // by optionsKey
+}
+
+func newDaemon(logger *log.Logger) (*daemon, error) {
+	d := &daemon{log: logger, repos: make(map[string]*cachedRepo)}
+	w, err := newWatcher(d.invalidate)
+	if err != nil {
+		return nil, err
+	}
+	d.watcher = w
+	return d, nil
+}
+
+// runDaemon serves status requests on the socket until interrupted
+func runDaemon(socket string) {
+	d, err := newDaemon(log.New(log.Writer(), log.Prefix(), log.Flags()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+	l, err := listenUnix(socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		l.Close()
+	}()
+
+	log.Printf("Listening on %s", socket)
+	d.serve(l)
+	os.Remove(socket)
+}
+
+// listenUnix listens on socket, replacing it if it was left behind
+// by a daemon that is no longer running. The socket's dir is created
+// if needed, and must pass checkSocket.
+func listenUnix(socket string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return nil, err
+	}
+	if err := checkSocket(socket); err != nil {
+		return nil, err
+	}
+	if conn, err := net.DialTimeout("unix", socket, daemonDialTimeout); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("daemon already running on %s", socket)
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return listenPrivate(socket)
+}
+
+// serve handles connections until l is closed
+func (d *daemon) serve(l net.Listener) {
+	go d.evictIdle()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+// handle answers a single request
+func (d *daemon) handle(conn net.Conn) {
+	defer conn.Close()
+	var req daemonRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		d.log.Printf("Error reading request: %s", err)
+		return
+	}
+	var resp daemonResponse
+	st, err := d.status(req)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Status = st
+	}
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		d.log.Printf("Error writing response: %s", err)
+	}
+}
+
+// status returns cached status for the request, collecting it if
+// the repo has changed since it was last cached
+func (d *daemon) status(req daemonRequest) (*gitstatus.Status, error) {
+	ctx := context.Background()
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	opts := req.Options
+	opts.Logger = d.log
+
+	repo, err := gitstatus.OpenRepo(req.Dir)
+	if err != nil || repo.WorkTree == "" {
+		return gitstatus.Collect(ctx, req.Dir, opts)
+	}
+	key := optionsKey(opts)
+
+	d.mu.Lock()
+	r := d.repos[repo.WorkTree]
+	if r == nil {
+		r = &cachedRepo{entries: make(map[string]*gitstatus.Status)}
+		d.repos[repo.WorkTree] = r
+		// A commit in a submodule changes the status of the repo
+		gitDirs := append([]string{repo.GitDir, repo.CommonDir}, repo.SubmoduleGitDirs()...)
+		if err := d.watcher.watch(repo.WorkTree, gitDirs...); err != nil {
+			d.log.Printf("Not caching %s: %s", repo.WorkTree, err)
+		}
+	}
+	r.lastUsed = time.Now()
+	if st, ok := r.entries[key]; ok {
+		d.mu.Unlock()
+		d.log.Printf("Cache hit for %s", req.Dir)
+		cp := *st
+		cp.WorkingDir = req.Dir
+		return &cp, nil
+	}
+	gen := r.gen
+	d.mu.Unlock()
+
+	st, err := gitstatus.Collect(ctx, req.Dir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Status collected while files were changing may already be stale,
+	// and nothing is cached once watches cannot be kept up to date
+	d.mu.Lock()
+	if r.gen == gen && !st.TimedOut && d.watcher.watching(repo.WorkTree) {
+		r.entries[key] = st
+	}
+	d.mu.Unlock()
+	return st, nil
+}
+
+// invalidate drops cached status for the repo at root
+func (d *daemon) invalidate(root string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if r, ok := d.repos[root]; ok {
+		r.gen++
+		r.entries = make(map[string]*gitstatus.Status)
+	}
+}
+
+// evictIdle periodically stops watching repos that are no longer queried
+func (d *daemon) evictIdle() {
+	for range time.Tick(time.Minute) {
+		d.mu.Lock()
+		for root, r := range d.repos {
+			if time.Since(r.lastUsed) > daemonIdleRepo {
+				d.log.Printf("Evicting idle repo %s", root)
+				d.watcher.unwatch(root)
+				delete(d.repos, root)
+			}
+		}
+		d.mu.Unlock()
+	}
+}
+
+// optionsKey identifies the options a status was collected with
+func optionsKey(opts gitstatus.Options) string {
+	opts.Logger = nil
+	return fmt.Sprintf("%+v", opts)
+}
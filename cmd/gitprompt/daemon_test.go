@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/comfortablynick/gitprompt/gitstatus"
+)
+
+// startDaemon starts a daemon on a socket in a temp dir, with an empty
+// repo in the same dir
+func startDaemon(t *testing.T) (d *daemon, socket, repo string, cleanup func()) {
+	t.Helper()
+	if _, err := exec.LookPath(gitstatus.GitExe); err != nil {
+		t.Skip("git not found")
+	}
+	d, err := newDaemon(log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Skip(err)
+	}
+
+	tmp, err := ioutil.TempDir("", "gitprompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo = filepath.Join(tmp, "repo")
+	if out, err := exec.Command(gitstatus.GitExe, "init", "-q", repo).CombinedOutput(); err != nil {
+		os.RemoveAll(tmp)
+		t.Fatalf("git init: %s\n%s", err, out)
+	}
+
+	socket = filepath.Join(tmp, "run", "gitprompt.sock")
+	l, err := listenUnix(socket)
+	if err != nil {
+		os.RemoveAll(tmp)
+		t.Fatal(err)
+	}
+	go d.serve(l)
+	return d, socket, repo, func() {
+		l.Close()
+		os.RemoveAll(tmp)
+	}
+}
+
+// waitCached queries the daemon until the status is cached, as the
+// first queries may be invalidated by git refreshing the index
+func waitCached(t *testing.T, d *daemon, socket string, req daemonRequest) *gitstatus.Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if time.Now().After(deadline) {
+			t.Fatal("status was never cached")
+		}
+		st, err := queryDaemon(context.Background(), socket, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.mu.Lock()
+		r := d.repos[req.Dir]
+		_, cached := r.entries[optionsKey(req.Options)]
+		d.mu.Unlock()
+		if cached {
+			return st
+		}
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	d, socket, repo, cleanup := startDaemon(t)
+	defer cleanup()
+
+	query := func() *gitstatus.Status {
+		t.Helper()
+		st, err := queryDaemon(context.Background(), socket, daemonRequest{Dir: repo})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+
+	waitCached(t, d, socket, daemonRequest{Dir: repo})
+	if st := query(); st.Untracked != 0 || st.WorkingDir != repo {
+		t.Errorf("unexpected cached status: %+v", st)
+	}
+
+	if _, err := listenUnix(socket); err == nil {
+		t.Error("expected error starting a second daemon on the same socket")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	writeFile := filepath.Join(repo, "new", "file.txt")
+	if err := os.MkdirAll(filepath.Dir(writeFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(writeFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for st := query(); st.Untracked != 1; st = query() {
+		if time.Now().After(deadline) {
+			t.Fatalf("cached status was not invalidated: %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueryDaemonNotRunning(t *testing.T) {
+	socket := filepath.Join(os.TempDir(), "gitprompt-test-missing.sock")
+	if _, err := queryDaemon(context.Background(), socket, daemonRequest{Dir: "."}); err == nil {
+		t.Error("expected error querying a daemon that is not running")
+	}
+}
+
+func TestDaemonStashDrop(t *testing.T) {
+	d, socket, repo, cleanup := startDaemon(t)
+	defer cleanup()
+
+	git := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-C", repo, "-c", "user.name=gitprompt", "-c", "user.email=gitprompt@example.com"}, args...)
+		if out, err := exec.Command(gitstatus.GitExe, args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s\n%s", args, err, out)
+		}
+	}
+	file := filepath.Join(repo, "a.txt")
+	git("commit", "-q", "--allow-empty", "-m", "initial")
+	for _, content := range []string{"one", "two"} {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "a.txt")
+		git("stash", "-q")
+	}
+
+	req := daemonRequest{Dir: repo, Options: gitstatus.Options{Stash: true}}
+	if st := waitCached(t, d, socket, req); st.Stashes != 2 {
+		t.Fatalf("expected 2 stash entries, got %d", st.Stashes)
+	}
+
+	// Dropping an older entry may change only the stash reflog, as
+	// `git reflog delete` always does
+	git("reflog", "delete", "refs/stash@{1}")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, err := queryDaemon(context.Background(), socket, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Stashes == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cached status was not invalidated: %d stash entries", st.Stashes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDaemonSubmoduleCommit(t *testing.T) {
+	d, socket, repo, cleanup := startDaemon(t)
+	defer cleanup()
+
+	git := func(dir string, args ...string) {
+		t.Helper()
+		args = append([]string{"-C", dir, "-c", "user.name=gitprompt", "-c", "user.email=gitprompt@example.com",
+			"-c", "protocol.file.allow=always"}, args...)
+		if out, err := exec.Command(gitstatus.GitExe, args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s\n%s", args, err, out)
+		}
+	}
+	lib := filepath.Join(filepath.Dir(repo), "lib")
+	git(filepath.Dir(repo), "init", "-q", lib)
+	git(lib, "commit", "-q", "--allow-empty", "-m", "lib")
+	git(repo, "submodule", "-q", "add", lib, "lib")
+	git(repo, "commit", "-q", "-m", "initial")
+
+	req := daemonRequest{Dir: repo}
+	if st := waitCached(t, d, socket, req); st.Unstaged.Modified != 0 {
+		t.Fatalf("expected no changes, got %+v", st.Unstaged)
+	}
+
+	// The commit only changes the submodule's git dir in .git/modules
+	git(filepath.Join(repo, "lib"), "commit", "-q", "--allow-empty", "-m", "change")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, err := queryDaemon(context.Background(), socket, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Unstaged.Modified == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cached status was not invalidated by a commit in the submodule")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCheckSocket(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gitprompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	socket := filepath.Join(tmp, "run", "gitprompt.sock")
+	l, err := listenUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := checkSocket(socket); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Dir(socket)); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("expected socket dir with mode 0700, got %v", fi.Mode())
+	}
+
+	if err := os.Chmod(socket, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocket(socket); err == nil {
+		t.Error("expected error for a socket other users can connect to")
+	}
+
+	if err := os.Chmod(tmp, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocket(filepath.Join(tmp, "gitprompt.sock")); err == nil {
+		t.Error("expected error for a socket in a dir other users can write to")
+	}
+	if _, err := listenUnix(filepath.Join(tmp, "gitprompt.sock")); err == nil {
+		t.Error("expected error listening in a dir other users can write to")
+	}
+
+	file := filepath.Join(tmp, "run", "file.sock")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocket(file); err == nil {
+		t.Error("expected error for a file that is not a socket")
+	}
+}
@@ -0,0 +1,579 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A format string is parsed into a tree of nodes, which is walked once
+// to find the data to collect and again to render the prompt. Verbs are
+// defined once in formatVerbs, so the two always agree.
+
+// formatVerb defines a %-verb of the format string
+type formatVerb struct {
+	need     func(o *Options)                         // marks the data the verb needs, if any
+	render   func(ri *RepoInfo, paint painter) string // returns "" if there is nothing to show
+	priority int                                      // verbs with lower priority are dropped first to fit --max-width
+}
+
+// formatVerbs are the verbs allowed in a format string, see the usage
+// text in main.go
+var formatVerbs = map[rune]formatVerb{
+	'g': {nil, func(ri *RepoInfo, paint painter) string { return glyphs["branch"] }, 1},
+	'n': {func(o *Options) { o.ShowVCS = true }, func(ri *RepoInfo, paint painter) string { return "git" }, 1},
+	'b': {
+		func(o *Options) { o.ShowBranch = true },
+		func(ri *RepoInfo, paint painter) string { return ri.fmtCleanDirty(paint, ri.Branch) },
+		9,
+	},
+	'r': {func(o *Options) { o.ShowRemote = true }, func(ri *RepoInfo, paint painter) string { return ri.Remote }, 2},
+	'a': {func(o *Options) { o.ShowAheadBehind = true }, (*RepoInfo).fmtAheadBehind, 5},
+	'c': {
+		func(o *Options) { o.ShowCommit = true },
+		func(ri *RepoInfo, paint painter) string { return ri.fmtCleanDirty(paint, ri.fmtCommit()) },
+		8,
+	},
+	'u': {
+		func(o *Options) { o.ShowUnknown = true },
+		func(ri *RepoInfo, paint painter) string {
+			if ri.Untracked == 0 {
+				return ""
+			}
+			return paint("untracked", glyphs["untracked"])
+		},
+		4,
+	},
+	'm': {
+		func(o *Options) { o.ShowUnstagedModified = true },
+		func(ri *RepoInfo, paint painter) string {
+			if !ri.Unstaged.HasChanged() {
+				return ""
+			}
+			return paint("unstaged", fmt.Sprintf("%s%d", glyphs["modified"], ri.Unstaged.Count()))
+		},
+		6,
+	},
+	's': {
+		func(o *Options) { o.ShowStagedModified = true },
+		func(ri *RepoInfo, paint painter) string {
+			if !ri.Staged.HasChanged() {
+				return ""
+			}
+			return paint("staged", fmt.Sprintf("%s%d", glyphs["modified"], ri.Staged.Count()))
+		},
+		6,
+	},
+	'd': {
+		func(o *Options) { o.ShowDiff = true },
+		func(ri *RepoInfo, paint painter) string {
+			if ri.Insertions+ri.Deletions == 0 {
+				return ""
+			}
+			return paint("diff", ri.fmtDiffStats())
+		},
+		3,
+	},
+	't': {
+		func(o *Options) { o.ShowStash = true },
+		func(ri *RepoInfo, paint painter) string {
+			if ri.Stashes == 0 {
+				return ""
+			}
+			return paint("stash", fmt.Sprintf("%s%d", glyphs["stash"], ri.Stashes))
+		},
+		3,
+	},
+	'x': {
+		func(o *Options) { o.ShowConflicts = true },
+		func(ri *RepoInfo, paint painter) string {
+			if ri.Conflicts.Count() == 0 {
+				return ""
+			}
+			return paint("conflicts", glyphs["unmerged"]+ri.Conflicts.String())
+		},
+		7,
+	},
+	'S': {func(o *Options) { o.ShowSubmodules = true }, (*RepoInfo).fmtSubmodules, 2},
+	'o': {
+		func(o *Options) { o.ShowOperation = true },
+		func(ri *RepoInfo, paint painter) string {
+			if ri.Operation.Name == "" {
+				return ""
+			}
+			return glyphs["operation"] + paint("operation", ri.Operation.String())
+		},
+		7,
+	},
+}
+
+// formatError is a syntax error in a format string
+type formatError struct {
+	col int    // 1-based column, in runes
+	tok string // offending text
+	msg string
+}
+
+func (e *formatError) Error() string {
+	return fmt.Sprintf("column %d: %s `%s'", e.col, e.msg, e.tok)
+}
+
+// caret returns the format with a line pointing at the error below it
+func (e *formatError) caret(format string) string {
+	prefix := []rune(format)
+	if e.col-1 < len(prefix) {
+		prefix = prefix[:e.col-1]
+	}
+	return format + "\n" + strings.Repeat(" ", displayWidth(string(prefix))) + "^"
+}
+
+// itemType identifies the type of a lexed item
+type itemType int
+
+const (
+	itemText       itemType = iota // literal text, including an escaped "%"
+	itemVerb                       // %-verb; val is the verb as written, ending with its letter
+	itemGroupStart                 // %{
+	itemGroupEnd                   // %}
+	itemFg                         // %F{color} or %f
+	itemBg                         // %K{color} or %k
+	itemEOF
+)
+
+// item is a lexed piece of a format string
+type item struct {
+	typ    itemType
+	val    string
+	col    int    // 1-based column of the item's first rune
+	styled bool   // verb has a %{style} prefix
+	style  string // color spec of a styled verb, %F or %K
+	width  int    // max columns of a verb; 0 for no limit
+	trunc  rune   // truncation strategy of a verb with a width
+}
+
+// formatLexer splits a format string into items
+type formatLexer struct {
+	input string
+	pos   int // byte offset of the next rune
+	col   int // column of the next rune
+}
+
+// next returns the rune at the current position and advances past it,
+// or utf8.RuneError at the end of input
+func (l *formatLexer) next() rune {
+	if l.pos >= len(l.input) {
+		return utf8.RuneError
+	}
+	r, n := utf8.DecodeRuneInString(l.input[l.pos:])
+	l.pos += n
+	l.col++
+	return r
+}
+
+// skipTo advances to the byte offset pos
+func (l *formatLexer) skipTo(pos int) {
+	for l.pos < pos {
+		l.next()
+	}
+}
+
+// item returns the next item of the input
+func (l *formatLexer) item() (item, error) {
+	start, col := l.pos, l.col
+	if start >= len(l.input) {
+		return item{typ: itemEOF, col: col}, nil
+	}
+	if l.input[start] != '%' {
+		for l.pos < len(l.input) && l.input[l.pos] != '%' {
+			l.next()
+		}
+		return item{typ: itemText, val: l.input[start:l.pos], col: col}, nil
+	}
+
+	l.next()
+	width, trunc, err := l.width()
+	if err != nil {
+		return item{}, err
+	}
+	if l.pos >= len(l.input) {
+		return item{}, &formatError{col, l.input[start:], "unterminated verb"}
+	}
+	verb := l.next()
+	if width > 0 {
+		return item{typ: itemVerb, val: l.input[start:l.pos], col: col, width: width, trunc: trunc}, nil
+	}
+	switch verb {
+	case '%':
+		return item{typ: itemText, val: "%", col: col}, nil
+	case '{':
+		if l.isStyle() {
+			return l.styledVerb()
+		}
+		return item{typ: itemGroupStart, val: "%{", col: col}, nil
+	case '}':
+		return item{typ: itemGroupEnd, val: "%}", col: col}, nil
+	case 'f':
+		return item{typ: itemFg, val: "%f", col: col}, nil
+	case 'k':
+		return item{typ: itemBg, val: "%k", col: col}, nil
+	case 'F', 'K':
+		return l.color(verb, col)
+	}
+	return item{typ: itemVerb, val: l.input[start:l.pos], col: col}, nil
+}
+
+// width lexes the optional width and truncation strategy of a verb,
+// ex: the "20=" of %20=b
+func (l *formatLexer) width() (int, rune, error) {
+	start, col := l.pos, l.col
+	for l.pos < len(l.input) && l.input[l.pos] >= '0' && l.input[l.pos] <= '9' {
+		l.next()
+	}
+	if l.pos == start {
+		return 0, truncEnd, nil
+	}
+	n, err := strconv.Atoi(l.input[start:l.pos])
+	if err != nil || n == 0 {
+		return 0, 0, &formatError{col, l.input[start:l.pos], "invalid width"}
+	}
+	trunc := rune(truncEnd)
+	if l.pos < len(l.input) {
+		switch r := rune(l.input[l.pos]); r {
+		case truncStart, truncMiddle, truncPath:
+			trunc = r
+			l.next()
+		}
+	}
+	return n, trunc, nil
+}
+
+// isStyle reports whether the %{ just read starts a style for the verb
+// after it, ex: %{fg:cyan,bold}b, rather than a group. A style holds no
+// "%" and is followed directly by the verb letter.
+func (l *formatLexer) isStyle() bool {
+	end := strings.IndexByte(l.input[l.pos:], '}')
+	if end <= 0 {
+		return false
+	}
+	after := l.pos + end + 1
+	return !strings.Contains(l.input[l.pos:l.pos+end], "%") &&
+		after < len(l.input) && l.input[after] != '%'
+}
+
+// styledVerb lexes the rest of a styled verb, after its %{
+func (l *formatLexer) styledVerb() (item, error) {
+	end := l.pos + strings.IndexByte(l.input[l.pos:], '}')
+	style, specCol := l.input[l.pos:end], l.col
+	spec, err := parseStyle(style)
+	if err != nil {
+		return item{}, &formatError{specCol, style, err.Error()}
+	}
+	l.skipTo(end + 1)
+	start, col := l.pos, l.col
+	width, trunc, err := l.width()
+	if err != nil {
+		return item{}, err
+	}
+	if l.pos >= len(l.input) {
+		return item{}, &formatError{col, l.input[start:], "unterminated verb"}
+	}
+	l.next()
+	return item{typ: itemVerb, val: l.input[start:l.pos], col: col, styled: true, style: spec, width: width, trunc: trunc}, nil
+}
+
+// color lexes the rest of %F{color} or %K{color}, after the F or K
+func (l *formatLexer) color(verb rune, col int) (item, error) {
+	typ, prefix := itemFg, ""
+	if verb == 'K' {
+		typ, prefix = itemBg, "bg:"
+	}
+	start := l.pos - 2
+	if l.next() != '{' {
+		return item{}, &formatError{col, "%" + string(verb), "expected `{' after"}
+	}
+	end := strings.IndexByte(l.input[l.pos:], '}')
+	if end < 0 {
+		return item{}, &formatError{col, "%" + string(verb) + "{", "unclosed"}
+	}
+	spec, specCol := l.input[l.pos:l.pos+end], l.col
+	if _, err := parseColor(prefix + spec); err != nil || spec == "" || strings.ContainsAny(spec, ", ") {
+		return item{}, &formatError{specCol, spec, "invalid color"}
+	}
+	l.skipTo(l.pos + end + 1)
+	return item{typ: typ, val: l.input[start:l.pos], col: col, style: prefix + spec}, nil
+}
+
+// parseStyle converts an inline style to a color spec. A style is comma
+// or space separated colors and attributes, with "fg:" or "bg:" before
+// colors, or "reset" for no color, ex: "fg:cyan,bold" is "cyan bold".
+func parseStyle(style string) (string, error) {
+	var words []string
+	for _, w := range strings.FieldsFunc(style, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if w != "reset" {
+			words = append(words, strings.TrimPrefix(w, "fg:"))
+		}
+	}
+	spec := strings.Join(words, " ")
+	if _, err := parseColor(spec); err != nil {
+		return "", errors.New("invalid style")
+	}
+	return spec, nil
+}
+
+// renderState is the color set by %F and %K while rendering
+type renderState struct {
+	fg, bg string // color specs; "" for the configured colors
+}
+
+// spec returns the color spec set by %F and %K, if any
+func (st *renderState) spec() (string, bool) {
+	if st.fg == "" && st.bg == "" {
+		return "", false
+	}
+	return strings.TrimSpace(st.fg + " " + st.bg), true
+}
+
+// formatNode is a node of a parsed format string
+type formatNode interface {
+	need(o *Options)
+
+	// render returns the node's output, and whether any verb in it
+	// showed something
+	render(ri *RepoInfo, st *renderState) (string, bool)
+
+	// priority returns the highest priority of the verbs in the node,
+	// or 0 if it has none
+	priority() int
+}
+
+// textNode is literal text
+type textNode string
+
+func (n textNode) need(o *Options) {}
+
+func (n textNode) render(ri *RepoInfo, st *renderState) (string, bool) {
+	if spec, ok := st.spec(); ok {
+		return paintSpec(spec, string(n)), false
+	}
+	return string(n), false
+}
+
+func (n textNode) priority() int { return 0 }
+
+// verbNode is a %-verb
+type verbNode struct {
+	verb   formatVerb
+	styled bool   // a %{style} prefix overrides the configured colors
+	style  string // color spec of the prefix; "" for no color
+	width  int    // max columns, ex: %20b; 0 for no limit
+	trunc  rune   // truncation strategy, see truncateWidth
+}
+
+func (n *verbNode) need(o *Options) {
+	if n.verb.need != nil {
+		n.verb.need(o)
+	}
+}
+
+// render shows the verb in its configured colors, unless a %{style}
+// prefix or %F or %K sets a color for all of it
+func (n *verbNode) render(ri *RepoInfo, st *renderState) (string, bool) {
+	spec, override := st.spec()
+	if n.styled {
+		spec, override = n.style, true
+	}
+	if !override {
+		out := n.truncate(n.verb.render(ri, paint))
+		return out, out != ""
+	}
+	out := n.truncate(n.verb.render(ri, func(part, s string) string { return s }))
+	if out == "" {
+		return "", false
+	}
+	return paintSpec(spec, out), true
+}
+
+func (n *verbNode) truncate(s string) string {
+	if n.width == 0 {
+		return s
+	}
+	return truncateWidth(s, n.width, n.trunc)
+}
+
+func (n *verbNode) priority() int { return n.verb.priority }
+
+// colorNode is %F, %f, %K or %k, which color the text and verbs after it
+type colorNode struct {
+	bg   bool
+	spec string // "" to restore the configured colors
+}
+
+func (n *colorNode) need(o *Options) {}
+
+func (n *colorNode) render(ri *RepoInfo, st *renderState) (string, bool) {
+	if n.bg {
+		st.bg = n.spec
+	} else {
+		st.fg = n.spec
+	}
+	return "", false
+}
+
+func (n *colorNode) priority() int { return 0 }
+
+// groupNode is a sequence of nodes; a whole format string is a group
+type groupNode []formatNode
+
+func (g groupNode) need(o *Options) {
+	for _, n := range g {
+		n.need(o)
+	}
+}
+
+func (g groupNode) render(ri *RepoInfo, st *renderState) (string, bool) {
+	var b strings.Builder
+	var shown bool
+	for _, n := range g {
+		out, ok := n.render(ri, st)
+		b.WriteString(out)
+		shown = shown || ok
+	}
+	return b.String(), shown
+}
+
+func (g groupNode) priority() int {
+	var p int
+	for _, n := range g {
+		if np := n.priority(); np > p {
+			p = np
+		}
+	}
+	return p
+}
+
+// fit renders the group in at most width columns, if width is above 0.
+// If it is too wide, the verbs and groups in it are dropped from the
+// lowest priority up, the last first among equals, until it fits or only
+// the most important one is left, which is then cut at the end. Each is
+// dropped with the text that separates it from the rest: the text before
+// it, or after it if it comes first.
+func (g groupNode) fit(ri *RepoInfo, width int) string {
+	out, _ := g.render(ri, &renderState{})
+	if width <= 0 || displayWidth(out) <= width {
+		return out
+	}
+	var order []int
+	for i, n := range g {
+		if n.priority() > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		pi, pj := g[order[i]].priority(), g[order[j]].priority()
+		if pi != pj {
+			return pi < pj
+		}
+		return order[i] > order[j]
+	})
+	fitted := append(groupNode(nil), g...)
+	dropped := make([]bool, len(g))
+	for k := 0; k < len(order)-1 && displayWidth(out) > width; k++ {
+		i := order[k]
+		fitted[i], dropped[i] = textNode(""), true
+		if j := fitted.separator(dropped, i, -1); j >= 0 {
+			fitted[j], dropped[j] = textNode(""), true
+		} else if j := fitted.separator(dropped, i, 1); j >= 0 {
+			fitted[j], dropped[j] = textNode(""), true
+		}
+		out, _ = fitted.render(ri, &renderState{})
+	}
+	return truncateWidth(out, width, truncEnd)
+}
+
+// separator returns the index of the text next to node i in direction
+// dir, skipping nodes already dropped, or -1 if the next node is not text
+func (g groupNode) separator(dropped []bool, i, dir int) int {
+	for j := i + dir; j >= 0 && j < len(g); j += dir {
+		if dropped[j] {
+			continue
+		}
+		if _, ok := g[j].(textNode); ok {
+			return j
+		}
+		return -1
+	}
+	return -1
+}
+
+// condNode is a group between %{ and %}, rendered only if a verb in it
+// shows something, so the text around the verbs is dropped with them
+type condNode struct {
+	body groupNode
+}
+
+func (n *condNode) need(o *Options) { n.body.need(o) }
+
+func (n *condNode) priority() int { return n.body.priority() }
+
+func (n *condNode) render(ri *RepoInfo, st *renderState) (string, bool) {
+	saved := *st
+	out, ok := n.body.render(ri, st)
+	if !ok {
+		// Colors set in a hidden group do not apply after it
+		*st = saved
+		return "", false
+	}
+	return out, true
+}
+
+// parseFormat parses a format string. Errors are *formatError.
+func parseFormat(format string) (groupNode, error) {
+	l := &formatLexer{input: format, col: 1}
+	g, end, err := parseGroup(l)
+	if err != nil {
+		return nil, err
+	}
+	if end.typ == itemGroupEnd {
+		return nil, &formatError{end.col, end.val, "unmatched group end"}
+	}
+	return g, nil
+}
+
+// parseGroup parses nodes up to the end of the input or of the current
+// group, returning the item that ended it
+func parseGroup(l *formatLexer) (groupNode, item, error) {
+	var g groupNode
+	for {
+		it, err := l.item()
+		if err != nil {
+			return nil, it, err
+		}
+		switch it.typ {
+		case itemEOF, itemGroupEnd:
+			return g, it, nil
+		case itemText:
+			g = append(g, textNode(it.val))
+		case itemVerb:
+			r, _ := utf8.DecodeLastRuneInString(it.val)
+			verb, ok := formatVerbs[r]
+			if !ok {
+				return nil, it, &formatError{it.col, it.val, "unknown verb"}
+			}
+			g = append(g, &verbNode{verb, it.styled, it.style, it.width, it.trunc})
+		case itemFg, itemBg:
+			g = append(g, &colorNode{it.typ == itemBg, it.style})
+		case itemGroupStart:
+			body, end, err := parseGroup(l)
+			if err != nil {
+				return nil, end, err
+			}
+			if end.typ != itemGroupEnd {
+				return nil, end, &formatError{it.col, it.val, "unclosed group"}
+			}
+			g = append(g, &condNode{body})
+		}
+	}
+}
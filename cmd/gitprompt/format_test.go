@@ -0,0 +1,225 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/comfortablynick/gitprompt/gitstatus"
+	"github.com/fatih/color"
+)
+
+func TestParseFormatErrors(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		err    string
+	}{
+		{"%b %", "column 4: unterminated verb `%'"},
+		{"%b %z", "column 4: unknown verb `%z'"},
+		{"Δ⎇ %%%Q", "column 6: unknown verb `%Q'"},
+		{"%", "column 1: unterminated verb `%'"},
+		{"%b%{ [%a]", "column 3: unclosed group `%{'"},
+		{"%{%{%a%} %b", "column 1: unclosed group `%{'"},
+		{"%b%{%a%}%}", "column 9: unmatched group end `%}'"},
+		{"%{ %q%}", "column 4: unknown verb `%q'"},
+	} {
+		_, err := parseFormat(tt.format)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%q: expected error %q, got %v", tt.format, tt.err, err)
+		}
+	}
+
+	_, err := parseFormat("ab %z")
+	if s := err.(*formatError).caret("ab %z"); s != "ab %z\n   ^" {
+		t.Errorf("unexpected caret:\n%s", s)
+	}
+	_, err = parseFormat("分支 %z")
+	if s := err.(*formatError).caret("分支 %z"); s != "分支 %z\n     ^" {
+		t.Errorf("unexpected caret:\n%s", s)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	defer func(old bool) { color.NoColor = old }(color.NoColor)
+	color.NoColor = true
+
+	format, err := parseFormat("[%n:%b] %a%m %u 100%%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o Options
+	format.need(&o)
+	if !o.ShowVCS || !o.ShowBranch || !o.ShowAheadBehind || !o.ShowUnstagedModified || !o.ShowUnknown ||
+		o.ShowStash || o.ShowCommit {
+		t.Errorf("unexpected data needed: %+v", o)
+	}
+
+	ri := &RepoInfo{Status: &gitstatus.Status{Branch: "master", Ahead: 2, Untracked: 1}}
+	want := "[git:master] " + glyphs["ahead"] + "2 " + glyphs["untracked"] + " 100%"
+	if out, ok := format.render(ri, &renderState{}); out != want || !ok {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+}
+
+func TestFormatGroups(t *testing.T) {
+	defer func(old bool) { color.NoColor = old }(color.NoColor)
+	color.NoColor = true
+
+	ri := &RepoInfo{Status: &gitstatus.Status{Branch: "master", Stashes: 2}}
+	for _, tt := range []struct {
+		format, want string
+	}{
+		{"%b%{ [%a]%}", "master"},
+		{"%b%{ [%t]%}", "master [" + glyphs["stash"] + "2]"},
+		{"%b%{ (%a%{, %t%})%}", "master (, " + glyphs["stash"] + "2)"},
+		{"%b%{ (%a%{, %u%})%}  |", "master  |"},
+		{"%{literal only%}%b", "master"},
+	} {
+		format, err := parseFormat(tt.format)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.format, err)
+		}
+		if out, _ := format.render(ri, &renderState{}); out != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.format, tt.want, out)
+		}
+	}
+}
+
+func TestFormatStyles(t *testing.T) {
+	defer func(old bool) { color.NoColor = old }(color.NoColor)
+	color.NoColor = false
+
+	ri := &RepoInfo{Status: &gitstatus.Status{Branch: "master", Ahead: 1, Stashes: 2}}
+	ahead, stash := glyphs["ahead"]+"1", glyphs["stash"]+"2"
+	for _, tt := range []struct {
+		format, want string
+	}{
+		{"%b", "\x1b[92mmaster\x1b[0m"},
+		{"%{fg:cyan,bold}b", "\x1b[36;1mmaster\x1b[0m"},
+		{"%{bg:blue italic}a", "\x1b[44;3m" + ahead + "\x1b[0m"},
+		{"%{reset}b", "master"},
+		{"%F{red}[%b]%f %t", "\x1b[31m[\x1b[0m\x1b[31mmaster\x1b[0m\x1b[31m]\x1b[0m " + stash},
+		{"%K{208}%b%k", "\x1b[48;5;208mmaster\x1b[0m"},
+		{"%F{red}%K{blue}%{bold}b%f%k", "\x1b[1mmaster\x1b[0m"},
+		{"%{%F{red} %u%}%b", "\x1b[92mmaster\x1b[0m"},
+		{"%{[%a]%}", "[\x1b[33m" + ahead + "\x1b[0m]"},
+	} {
+		format, err := parseFormat(tt.format)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.format, err)
+		}
+		if out, _ := format.render(ri, &renderState{}); out != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.format, tt.want, out)
+		}
+	}
+
+	for _, tt := range []struct {
+		format, err string
+	}{
+		{"%{fg:chartreuse}b", "column 3: invalid style `fg:chartreuse'"},
+		{"%{bold}z", "column 8: unknown verb `z'"},
+		{"%F{red}%b%F", "column 10: expected `{' after `%F'"},
+		{"%Fred", "column 1: expected `{' after `%F'"},
+		{"%K{blue", "column 1: unclosed `%K{'"},
+		{"%F{red,bold}b", "column 4: invalid color `red,bold'"},
+		{"%F{}b", "column 4: invalid color `'"},
+	} {
+		_, err := parseFormat(tt.format)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%q: expected error %q, got %v", tt.format, tt.err, err)
+		}
+	}
+}
+
+func TestFormatWidth(t *testing.T) {
+	defer func(old bool) { color.NoColor = old }(color.NoColor)
+	color.NoColor = true
+	defer func(old glyphSet) { glyphs = old }(glyphs)
+	glyphs = glyphSets["unicode"].copy()
+
+	ri := &RepoInfo{Status: &gitstatus.Status{Branch: "feature/JIRA-12345-login", Ahead: 1}}
+	for _, tt := range []struct {
+		format, want string
+	}{
+		{"%10b", "feature/J…"},
+		{"%10<b", "…345-login"},
+		{"%10=b", "featu…ogin"},
+		{"%16/b", "f/JIRA-12345-lo…"},
+		{"%99b", "feature/JIRA-12345-login"},
+		{"%{reset}8b%{ %3a%}", "feature… ↑1"},
+	} {
+		format, err := parseFormat(tt.format)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.format, err)
+		}
+		if out, _ := format.render(ri, &renderState{}); out != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.format, tt.want, out)
+		}
+	}
+
+	for _, tt := range []struct {
+		format, err string
+	}{
+		{"%0b", "column 2: invalid width `0'"},
+		{"%b %20", "column 4: unterminated verb `%20'"},
+		{"%20z", "column 1: unknown verb `%20z'"},
+		{"%20%", "column 1: unknown verb `%20%'"},
+		{"%{bold}5=q", "column 8: unknown verb `5=q'"},
+	} {
+		_, err := parseFormat(tt.format)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%q: expected error %q, got %v", tt.format, tt.err, err)
+		}
+	}
+}
+
+func TestFormatFit(t *testing.T) {
+	defer func(old bool) { color.NoColor = old }(color.NoColor)
+	color.NoColor = true
+	defer func(old glyphSet) { glyphs = old }(glyphs)
+	glyphs = glyphSets["ascii"].copy()
+
+	ri := &RepoInfo{Status: &gitstatus.Status{
+		Branch:    "master",
+		Commit:    "0123456789abcdef",
+		Ahead:     2,
+		Untracked: 1,
+		Stashes:   3,
+	}}
+	format, err := parseFormat("%b@%c%{ %a%}%{ %u%}%{ %t%}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		width int
+		want  string
+	}{
+		{0, "master@0123456 ^2 ? $3"},
+		{22, "master@0123456 ^2 ? $3"},
+		{21, "master@0123456 ^2 ?"},
+		{17, "master@0123456 ^2"},
+		{16, "master@0123456"},
+		{10, "master"},
+		{4, "m..."},
+	} {
+		if out := format.fit(ri, tt.width); out != tt.want {
+			t.Errorf("width %d: expected %q, got %q", tt.width, tt.want, out)
+		}
+	}
+
+	// Text outside groups is dropped with the verb it separates
+	glyphs["branch"] = "git:"
+	if format, err = parseFormat("%g %b%{ %a%}"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		width int
+		want  string
+	}{
+		{14, "git: master ^2"},
+		{13, "master ^2"},
+		{8, "master"},
+	} {
+		if out := format.fit(ri, tt.width); out != tt.want {
+			t.Errorf("width %d: expected %q, got %q", tt.width, tt.want, out)
+		}
+	}
+}
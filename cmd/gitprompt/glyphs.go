@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// glyphSet maps each glyph name to the text shown for it
+type glyphSet map[string]string
+
+// glyphSets are the built-in glyph sets, selected with --glyphs. Every
+// set has the same glyphs; the config file may override any of them.
+var glyphSets = map[string]glyphSet{
+	// default is unicode with the powerline branch glyph, which most
+	// prompt fonts have; it was the only set before glyph sets existed
+	"default": {
+		"branch":    "\ue0a0", // nf-pl-branch
+		"modified":  "Δ",
+		"dirty":     "✘", // ✗
+		"clean":     "✔", // ✓
+		"untracked": "?",
+		"unmerged":  "‼",
+		"ahead":     "↑",
+		"behind":    "↓",
+		"stash":     "$",
+		"operation": "|",
+		"submodule": "§",
+		"timeout":   "⌛",
+		"stale":     "↻",
+		"ellipsis":  "…",
+	},
+	// nerdfont needs a patched font, see https://www.nerdfonts.com
+	"nerdfont": {
+		"branch":    "\ue0a0", // nf-pl-branch
+		"modified":  "\uf044", // nf-fa-pencil_square_o
+		"dirty":     "\uf00d", // nf-fa-times
+		"clean":     "\uf00c", // nf-fa-check
+		"untracked": "\uf128", // nf-fa-question
+		"unmerged":  "\uf071", // nf-fa-warning
+		"ahead":     "\uf062", // nf-fa-arrow_up
+		"behind":    "\uf063", // nf-fa-arrow_down
+		"stash":     "\uf01c", // nf-fa-inbox
+		"operation": "\uf110", // nf-fa-spinner
+		"submodule": "\uf1d2", // nf-fa-git_square
+		"timeout":   "\uf252", // nf-fa-hourglass_half
+		"stale":     "\uf021", // nf-fa-refresh
+		"ellipsis":  "…",
+	},
+	"unicode": {
+		"branch":    "⎇",
+		"modified":  "Δ",
+		"dirty":     "✘", // ✗
+		"clean":     "✔", // ✓
+		"untracked": "?",
+		"unmerged":  "‼",
+		"ahead":     "↑",
+		"behind":    "↓",
+		"stash":     "$",
+		"operation": "|",
+		"submodule": "§",
+		"timeout":   "⌛",
+		"stale":     "↻",
+		"ellipsis":  "…",
+	},
+	"ascii": {
+		"branch":    "",
+		"modified":  "~",
+		"dirty":     "x",
+		"clean":     "=",
+		"untracked": "?",
+		"unmerged":  "!",
+		"ahead":     "^",
+		"behind":    "v",
+		"stash":     "$",
+		"operation": "|",
+		"submodule": "S",
+		"timeout":   "...",
+		"stale":     "*",
+		"ellipsis":  "...",
+	},
+}
+
+// glyphs are the glyphs shown in the prompt, set from the glyph set
+// and the config file
+var glyphs = glyphSets["default"].copy()
+
+// useGlyphs sets glyphs to the named glyph set, or for "auto", to
+// default if the terminal and locale support it and ascii otherwise
+func useGlyphs(name string) error {
+	if name == "auto" {
+		name = detectGlyphs()
+	}
+	set, ok := glyphSets[name]
+	if !ok {
+		var names []string
+		for name := range glyphSets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown glyph set `%s', expected one of: auto, %s", name, strings.Join(names, ", "))
+	}
+	glyphs = set.copy()
+	return nil
+}
+
+// detectGlyphs returns default if the locale's charset is UTF-8 and
+// the terminal is not a console known to lack the glyphs
+func detectGlyphs() string {
+	switch os.Getenv("TERM") {
+	case "dumb", "linux", "vt100", "vt220", "cons25":
+		return "ascii"
+	}
+	// The first one set wins; see locale(7)
+	for _, env := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale := os.Getenv(env); locale != "" {
+			locale = strings.ToLower(locale)
+			if strings.Contains(locale, "utf-8") || strings.Contains(locale, "utf8") {
+				return "default"
+			}
+			return "ascii"
+		}
+	}
+	return "ascii"
+}
+
+func (g glyphSet) copy() glyphSet {
+	cp := make(glyphSet, len(g))
+	for name, glyph := range g {
+		cp[name] = glyph
+	}
+	return cp
+}
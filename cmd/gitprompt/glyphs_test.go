@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGlyphSets(t *testing.T) {
+	for name, set := range glyphSets {
+		if len(set) != len(glyphSets["unicode"]) {
+			t.Errorf("glyph set %s has %d glyphs, unicode has %d", name, len(set), len(glyphSets["unicode"]))
+		}
+		for glyph := range set {
+			if _, ok := glyphSets["unicode"][glyph]; !ok {
+				t.Errorf("glyph set %s has unknown glyph %s", name, glyph)
+			}
+		}
+	}
+	for glyph, s := range glyphSets["ascii"] {
+		for _, r := range s {
+			if r > 0x7f {
+				t.Errorf("ascii glyph %s is %q", glyph, s)
+			}
+		}
+	}
+}
+
+func TestDetectGlyphs(t *testing.T) {
+	vars := []string{"TERM", "LC_ALL", "LC_CTYPE", "LANG"}
+	old := make(map[string]string)
+	for _, v := range vars {
+		old[v] = os.Getenv(v)
+	}
+	defer func(g glyphSet) {
+		glyphs = g
+		for v, s := range old {
+			os.Setenv(v, s)
+		}
+	}(glyphs)
+
+	for _, tt := range []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"TERM": "xterm-256color", "LANG": "en_US.UTF-8"}, "default"},
+		{map[string]string{"TERM": "xterm", "LC_ALL": "C", "LANG": "en_US.UTF-8"}, "ascii"},
+		{map[string]string{"TERM": "xterm", "LC_CTYPE": "de_DE.utf8"}, "default"},
+		{map[string]string{"TERM": "linux", "LANG": "en_US.UTF-8"}, "ascii"},
+		{map[string]string{"TERM": "xterm"}, "ascii"},
+	} {
+		for _, v := range vars {
+			os.Setenv(v, tt.env[v])
+		}
+		if got := detectGlyphs(); got != tt.want {
+			t.Errorf("%v: expected %s, got %s", tt.env, tt.want, got)
+		}
+	}
+
+	os.Setenv("LANG", "en_US.UTF-8")
+	os.Setenv("TERM", "xterm")
+	if err := useGlyphs("auto"); err != nil || glyphs["branch"] != glyphSets["default"]["branch"] {
+		t.Errorf("expected default glyphs, got %v %v", err, glyphs)
+	}
+	if err := useGlyphs("wingdings"); err == nil {
+		t.Error("expected error for unknown glyph set")
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const (
+	version = `
+gitprompt version 0.0.1
+
+© 2019 Nicholas Murphy
+(github.com/comfortablynick)
+`
+	defaultFormat = "%{%g %}%b%a%{ %m%d%u%t%}%{ %s%}"
+)
+
+// Options defines command line args and options
+type Options struct {
+	NoColor              bool
+	Verbose              bool
+	Version              bool
+	Dir                  string
+	Timeout              int
+	Format               string
+	NoGitTag             bool
+	Simple               bool
+	Output               string
+	Shell                string
+	Backend              string
+	Socket               string
+	Cache                bool
+	CacheMaxAge          time.Duration
+	Async                bool
+	StaleGlyph           string
+	Notify               int
+	Profile              string
+	Theme                string
+	Glyphs               string
+	MaxWidth             int
+	HideUntracked        bool // set by gitprompt.showUntracked in the repo config
+	HideDiff             bool // set by gitprompt.showDiff in the repo config
+	Disable              bool // set by gitprompt.disable in the repo config
+	Command              string
+	ShowVCS              bool
+	ShowAheadBehind      bool
+	ShowBranch           bool
+	ShowRemote           bool
+	ShowCommit           bool
+	ShowUnstagedModified bool
+	ShowStagedModified   bool
+	ShowUnknown          bool
+	ShowStash            bool
+	ShowDiff             bool
+	ShowGitDir           bool
+	ShowOperation        bool
+	ShowConflicts        bool
+	ShowSubmodules       bool
+	Files                bool
+	RecurseSubmodules    bool
+}
+
+var (
+	cwd          string
+	options      Options
+	promptFormat groupNode // parsed from options.Format
+
+	// argFlags are the flags given on the command line, which override
+	// the config file and repo config
+	argFlags = make(map[string]bool)
+)
+
+func init() {
+	flag.BoolVar(&options.NoColor, "n", false, "do not print color on prompt")
+	flag.BoolVar(&options.Verbose, "v", false, "print verbose debug messages")
+	flag.BoolVar(&options.Version, "version", false, "show version info and exit")
+	flag.StringVar(&options.Dir, "d", "", "git repo location, if not cwd")
+	flag.IntVar(&options.Timeout, "t", 0, "timeout for git commands in milliseconds (0 for none)")
+	flag.StringVar(&options.Format, "f", defaultFormat, "printf-style format string for git prompt")
+	flag.StringVar(&options.Output, "o", "string", "output type: string, raw, json, sh, zsh, fish, {1,2,3...}")
+	flag.StringVar(&options.Shell, "shell", "none", "wrap color codes as zero-width for shell: bash, zsh, tcsh, fish, none")
+	flag.StringVar(&options.Backend, "backend", "git", "status backend: git, or native to read the index and work tree directly")
+	flag.StringVar(&options.Socket, "socket", defaultSocketPath(), "unix socket of the caching daemon")
+	flag.BoolVar(&options.Cache, "cache", false, "reuse status cached on disk while the index, HEAD and refs are unchanged")
+	flag.DurationVar(&options.CacheMaxAge, "cache-max-age", 10*time.Second, "max age of cached status, which does not see unstaged work tree changes")
+	flag.BoolVar(&options.Async, "async", false, "print cached status immediately and refresh it in the background")
+	flag.StringVar(&options.StaleGlyph, "stale-glyph", "", "glyph appended to stale status in async mode, if not the one from the glyph set")
+	flag.IntVar(&options.Notify, "notify", 0, "send SIGUSR1 to this pid after an async refresh, ex: -notify $$")
+	flag.BoolVar(&options.NoGitTag, "no-tag", false, "do not look for git tag if detached head")
+	flag.BoolVar(&options.Files, "files", false, "list each changed file with its status code instead of a prompt")
+	flag.BoolVar(&options.RecurseSubmodules, "submodules", false, "run status in each submodule to show its branch and dirty state")
+	flag.BoolVar(&options.Simple, "s", false, "simple mode; emulates default bash git prompt")
+	flag.StringVar(&options.Profile, "p", "", "apply the named profile from the config file")
+	flag.StringVar(&options.Glyphs, "glyphs", "auto", "glyph set: default, nerdfont, unicode, ascii, or auto to use ascii unless the locale is UTF-8")
+	flag.StringVar(&options.Theme, "theme", "default", "color theme: default, mono, gruvbox, solarized")
+	flag.IntVar(&options.MaxWidth, "max-width", 0, "max columns of the prompt, dropping the least important verbs first (0 for none)")
+
+	epilog := `
+	Output Examples:
+
+	[-o=s/string]
+	  Prints based on [-f] FORMAT, which may contain:
+	  %g  branch glyph, ex: "" (see [-glyphs])
+	  %n  VC name
+	  %b  branch
+	  %r  remote
+	  %a  commits ahead/behind remote
+	  %c  current commit hash
+	  %m  unstaged changes (modified/added/removed)
+	  %s  staged changes (modified/added/removed)
+	  %u  untracked files
+	  %d  diff lines, ex: "+20/-10"
+	  %t  stash count, ex: "$3"
+	  %x  conflicts by type, ex: "‼UU2 DU1"
+	  %S  submodules with new commits/modified/untracked content, ex: "§C1M2"
+	  %o  operation in progress, ex: "REBASE-i 2/5", "MERGING"
+	  %%  a literal "%"
+
+	  Text between %{ and %} is a group, shown only if a verb inside it
+	  shows something, ex: "%b%{ [%a]%}" prints "master" when in sync
+	  with the remote, "master [↑1]" when ahead. Groups may be nested.
+
+	  Styles override the theme's colors: %{STYLE}X shows verb X in
+	  STYLE, ex: "%{fg:cyan,bold}b", "%{bg:236}a", "%{reset}b" for no
+	  color. %F{COLOR} and %K{COLOR} set the foreground and background
+	  of everything after them until %f and %k, ex: "%F{red}[%b]%f".
+
+	  A width after the "%" limits a verb to that many columns, cutting
+	  it at the end, ex: "%20b". A "<", "=" or "/" after the width cuts
+	  the start or middle instead, or for "/" shortens the dirs of a
+	  branch path first, ex: "%16/b" prints "f/JIRA-1234-fix…".
+	  [-max-width] drops the least important verbs and groups, along
+	  with the text separating them, then cuts the rest to fit.
+
+	[-o=r/raw]
+	  Prints each value on a new line for easy parsing
+
+	[-o=j/json]
+	  Prints all values as a JSON object with a schema_version field
+
+	[-o=sh/zsh/fish]
+	  Prints quoted GITPROMPT_* variable assignments for the shell
+	  ex: eval "$(gitprompt -o sh)"
+
+	[-o={1,2,3...}]
+	  Presets: sensible presets for ease of use
+		
+	  1: [%n:%b] (vcprompt default)
+	  2: %b %c%{ %a%}%{ %u%}%{ %m%}
+	  3: %{%g %}%b@%c%{ %a%}%{ %u%}%{ %m%}%{ %s%} (similar to porcelain)
+
+	Daemon:
+
+	  gitprompt daemon
+	  Keeps status of each repo in memory, refreshing it when files
+	  change. Prompts use the daemon on [-socket] if it is running.
+
+	Config:
+
+	  Defaults for the flags above, glyphs and colors are read from
+	  $GITPROMPT_CONFIG or ~/.config/gitprompt/config.toml. Profiles in
+	  [profiles.NAME] tables are applied with [-p NAME]. Flags override
+	  the file.
+
+	  gitprompt config dump
+	  Prints the effective config.
+	`
+	flag.Usage = func() {
+		usageMsg := `
+		Usage: gitprompt [-h] [-v] [-d DIR] [-t MS] [-f FORMAT]
+		       gitprompt daemon [-v] [-socket PATH]
+		       gitprompt config dump [-p PROFILE]
+
+		Git status for your prompt, similar to Greg Ward's vcprompt.
+
+		Optional Arguments:
+		`
+		fmt.Fprintln(os.Stderr, detent(usageMsg))
+		flag.PrintDefaults()
+		fmt.Println(detent(epilog))
+	}
+}
+
+// parseArgs parses command line flags and applies them to options
+func parseArgs() {
+	flag.Parse()
+
+	// Flags may also follow a subcommand, ex: `gitprompt daemon -v`
+	var command []string
+	for flag.NArg() > 0 {
+		command = append(command, flag.Arg(0))
+		flag.CommandLine.Parse(flag.Args()[1:]) // #nosec: exits on error
+	}
+	options.Command = strings.Join(command, " ")
+	flag.CommandLine.Visit(func(f *flag.Flag) { argFlags[f.Name] = true })
+
+	// Discard logs unless --verbose is set
+	logFile := ioutil.Discard
+
+	if options.Verbose {
+		logFile = os.Stderr
+	}
+
+	log.SetOutput(logFile)
+	log.Printf("Raw args: %v", os.Args[1:])
+
+	switch options.Command {
+	case "", "daemon", "config dump":
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown command `%v'\n", options.Command)
+		os.Exit(1)
+	}
+
+	if err := loadConfig(flag.CommandLine, options.Profile); err != nil {
+		fmt.Fprintf(os.Stderr, "error: config: %s\n", err)
+		os.Exit(1)
+	}
+
+	if options.Version {
+		fmt.Print(version)
+		os.Exit(0)
+	}
+
+	// Handle regular options
+	if options.Dir != "" {
+		cwd = options.Dir
+	}
+
+	if options.NoColor {
+		color.NoColor = true
+	}
+
+	if options.Output == "r" {
+		options.Output = "raw"
+	}
+	if options.Output == "s" {
+		options.Output = "string"
+	}
+	if options.Output == "j" {
+		options.Output = "json"
+	}
+
+	switch options.Shell {
+	case "bash", "zsh", "tcsh", "fish", "none":
+	default:
+		fmt.Printf("error: invalid shell `%v'", options.Shell)
+		os.Exit(1)
+	}
+
+	switch options.Backend {
+	case "git", "native":
+	default:
+		fmt.Printf("error: invalid backend `%v'", options.Backend)
+		os.Exit(1)
+	}
+
+	presets := [3]string{
+		"[%n:%b]",
+		"%b %c%{ %a%}%{ %u%}%{ %m%}",
+		"%{%g %}%b@%c%{ %a%}%{ %u%}%{ %m%}%{ %s%}",
+	}
+
+	// A preset on the command line overrides the repo's format as -f does
+	switch options.Output {
+	case "1", "2", "3":
+		argFlags["f"] = argFlags["f"] || argFlags["o"]
+	}
+
+	switch options.Output {
+	case "json", "sh", "zsh", "fish":
+		options.ShowGitDir = true
+		fallthrough
+	case "raw":
+		options.ShowAheadBehind = true
+		options.ShowBranch = true
+		options.ShowDiff = true
+		options.ShowCommit = true
+		options.ShowStagedModified = true
+		options.ShowStash = true
+		options.ShowUnknown = true
+		options.ShowUnstagedModified = true
+		options.ShowOperation = true
+	case "1":
+		options.Format = presets[0]
+		options.Output = "string"
+	case "2":
+		options.Format = presets[1]
+		options.Output = "string"
+	case "3":
+		options.Format = presets[2]
+		options.Output = "string"
+	case "string":
+	default:
+		fmt.Printf("error: invalid output format `%v'", options.Output)
+		os.Exit(1)
+	}
+
+	if cwd == "" {
+		var err error
+		if cwd, err = os.Getwd(); err != nil {
+			log.Printf("Error getting cwd: %s", err)
+		}
+	}
+}
+
+// parseFormatString parses the format string and marks the data it needs
+func parseFormatString() {
+	format, err := parseFormat(options.Format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid format string: %s\n", err)
+		if ferr, ok := err.(*formatError); ok {
+			fmt.Fprintln(os.Stderr, ferr.caret(options.Format))
+		}
+		os.Exit(1)
+	}
+	format.need(&options)
+	promptFormat = format
+}
+
+// needsStatus reports whether the format uses data from `git status`,
+// as opposed to refs which can be read without running git. Branch
+// and commit are colored by dirty state, so need status unless the
+// output is uncolored.
+func (o *Options) needsStatus() bool {
+	return o.ShowAheadBehind || (o.ShowUnknown && !o.HideUntracked) || o.ShowUnstagedModified ||
+		o.ShowStagedModified || (o.ShowDiff && !o.HideDiff) || o.ShowConflicts || o.ShowSubmodules ||
+		o.RecurseSubmodules || ((o.ShowBranch || o.ShowCommit) && !color.NoColor)
+}
+
+func main() {
+	parseArgs()
+	log.Printf("Running gitprompt in directory %s", cwd)
+
+	ctx := context.Background()
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(options.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+
+	switch options.Command {
+	case "daemon":
+		runDaemon(options.Socket)
+		return
+	case "config dump":
+		if err := dumpConfig(os.Stdout, flag.CommandLine); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Repo config overrides global options, so is read before the
+	// format string decides what to collect
+	if err := loadRepoConfig(cwd); err != nil {
+		fmt.Fprintf(os.Stderr, "error: repo config: %s\n", err)
+		os.Exit(1)
+	}
+	if options.Disable {
+		log.Println("Disabled by gitprompt.disable")
+		return
+	}
+
+	if options.Simple {
+		log.Println("Simple mode")
+		runSimple(ctx)
+		return
+	}
+
+	if options.Output == "string" && !options.Files {
+		parseFormatString()
+	}
+
+	// Background refresh started by --async; the parent printed the prompt
+	if os.Getenv(asyncRefreshEnv) != "" {
+		refreshCache()
+		return
+	}
+
+	if options.Files {
+		fmt.Println(run(ctx).FmtFiles())
+		return
+	}
+
+	switch options.Output {
+	case "string":
+		fmt.Println(run(ctx).fmtString())
+	case "json":
+		fmt.Println(run(ctx).FmtJSON())
+	case "sh", "zsh", "fish":
+		fmt.Println(run(ctx).FmtShell(options.Output))
+	default:
+		fmt.Println(run(ctx).FmtRaw())
+	}
+
+	// fmt.Print(run().Fmt())
+	log.Printf("Options: %+v", options)
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/comfortablynick/gitprompt/gitstatus"
+	"github.com/fatih/color"
+)
+
+// RepoInfo wraps gitstatus.Status with prompt formatting
+type RepoInfo struct {
+	*gitstatus.Status
+	Stale bool // cached status shown while a refresh runs in the background
+}
+
+// colors are the color specs of each part of the prompt, set from
+// the theme and the config file
+var colors = themes["default"].copy()
+
+// painter colors s as the named part of the prompt; paint uses the
+// configured colors, and the format string may override them
+type painter func(part, s string) string
+
+// paint colors s with the color configured for part of the prompt
+func paint(part, s string) string {
+	return paintSpec(colors[part], s)
+}
+
+// paintSpec colors s with a color spec, see parseColor
+func paintSpec(spec, s string) string {
+	c, err := parseColor(spec)
+	if err != nil || c == nil {
+		return s
+	}
+	return c.Sprint(s)
+}
+
+// TODO: parse first, then format if called for by user
+
+// fmtCleanDirty changes color depending on repo status
+func (ri *RepoInfo) fmtCleanDirty(paint painter, s string) string {
+	if s == "" {
+		return ""
+	}
+	if ri.Unstaged.HasChanged() {
+		return paint("branch_dirty", s)
+	}
+	if ri.Staged.HasChanged() {
+		return paint("branch_staged", s)
+	}
+	return paint("branch_clean", s)
+}
+
+// Fmt formats the output for the shell
+func (ri *RepoInfo) Fmt() string {
+	// TODO: make format user-configurable
+	log.Println(ri.Debug(false))
+
+	// Turn off color based on CLI option
+	color.NoColor = options.NoColor
+
+	cleanDirtyFmt := (func() func(...interface{}) string {
+		if ri.Unstaged.HasChanged() {
+			return color.New(color.FgHiRed).SprintFunc()
+		}
+		if ri.Staged.HasChanged() {
+			return color.New(color.FgHiYellow).SprintFunc()
+		}
+		return color.New(color.FgHiGreen).SprintFunc()
+	})()
+
+	return fmt.Sprintf("%s %s@%s %s %s %s %s",
+		glyphs["branch"],
+		cleanDirtyFmt(ri.Branch),
+		cleanDirtyFmt(ri.fmtCommit()),
+		func() string {
+			var buf bytes.Buffer
+			if ri.Ahead > 0 {
+				if _, err := buf.WriteString(fmt.Sprintf(" %s%d ", glyphs["ahead"], ri.Ahead)); err != nil {
+					log.Printf("Buffer error: %s", err)
+				}
+			}
+			if ri.Behind > 0 {
+				if _, err := buf.WriteString(fmt.Sprintf(" %s%d ", glyphs["behind"], ri.Behind)); err != nil {
+					log.Printf("Buffer error: %s", err)
+				}
+			}
+			return buf.String()
+		}(),
+		func() string {
+			var buf bytes.Buffer
+			untracked, unmerged, modified := glyphs["untracked"], glyphs["unmerged"], glyphs["modified"]
+			if ri.Untracked == 0 {
+				untracked = " "
+			}
+			if ri.Unmerged == 0 && ri.Operation.Name != "MERGING" {
+				unmerged = " "
+			}
+			if !ri.Unstaged.HasChanged() {
+				modified = " "
+			}
+			if _, err := buf.WriteString(untracked + unmerged + modified); err != nil {
+				log.Printf("Error writing glyphs: %s", err)
+			}
+			return buf.String()
+		}(),
+		func() string {
+			if ri.Staged.HasChanged() {
+				return glyphs["dirty"]
+			}
+			return glyphs["clean"]
+		}(),
+		func() string {
+			var out string
+			if ri.Insertions > 0 {
+				out += fmt.Sprintf("+%d", ri.Insertions)
+			}
+			if ri.Deletions > 0 {
+				out += fmt.Sprintf(" -%d", ri.Deletions)
+			}
+			return strings.TrimSpace(out)
+		}(),
+	)
+}
+
+// fmtString renders the format string parsed by parseFormatString
+func (ri *RepoInfo) fmtString() string {
+	log.Println(ri.Debug(false))
+
+	var suffix string
+	if ri.TimedOut {
+		suffix += " " + paint("timeout", glyphs["timeout"])
+	}
+	if ri.Stale {
+		suffix += " " + paint("stale", glyphs["stale"])
+	}
+	width := options.MaxWidth
+	if width > 0 {
+		// Keep the markers, which tell the rest may be wrong
+		width -= displayWidth(suffix)
+		if width < 1 {
+			width = 1
+		}
+	}
+	out := promptFormat.fit(ri, width) + suffix
+	return promptEscape(out, options.Shell)
+}
+
+// fmtCommit returns the abbreviated commit hash. The commit is empty if
+// status timed out before git printed it.
+func (ri *RepoInfo) fmtCommit() string {
+	if ri.Commit == "(initial)" || len(ri.Commit) < 7 {
+		return ri.Commit
+	}
+	return ri.Commit[:7]
+}
+
+func (ri *RepoInfo) fmtRemote() string {
+	if ri.Remote == "" {
+		return "_NO_REMOTE_TRACKING_"
+	}
+	return ri.Remote
+}
+
+func (ri *RepoInfo) fmtUpstream() string {
+	if ri.Upstream == "" {
+		return "."
+	}
+	return ri.Upstream
+}
+
+// fmtSubmodules formats submodule counts and, if collected,
+// each submodule's branch colored by its dirty state
+func (ri *RepoInfo) fmtSubmodules(paint painter) string {
+	var out []string
+	if ri.Submodules.HasChanged() {
+		out = append(out, paint("submodules", glyphs["submodule"]+ri.Submodules.String()))
+	}
+	for _, s := range ri.SubmoduleStatus {
+		str := fmt.Sprintf("%s:%s", filepath.Base(s.Path), s.Branch)
+		if s.Dirty {
+			out = append(out, paint("branch_dirty", str))
+		} else {
+			out = append(out, paint("branch_clean", str))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func (ri *RepoInfo) fmtOperation() string {
+	if ri.Operation.Name == "" {
+		return "."
+	}
+	return ri.Operation.String()
+}
+
+func (ri *RepoInfo) fmtAheadBehind(paint painter) string {
+	var ab string
+	if ri.Ahead != 0 {
+		ab += paint("ahead", fmt.Sprintf("%s%d", glyphs["ahead"], ri.Ahead))
+	}
+	if ri.Behind != 0 {
+		ab += paint("behind", fmt.Sprintf("%s%d", glyphs["behind"], ri.Behind))
+	}
+	return ab
+}
+
+func (ri *RepoInfo) fmtDiffStats() string {
+	return func() string {
+		if ri.Insertions != 0 && ri.Deletions != 0 {
+			return fmt.Sprintf("+%d/-%d", ri.Insertions, ri.Deletions)
+		}
+		if ri.Insertions != 0 {
+			return fmt.Sprintf("+%d", ri.Insertions)
+		}
+		return fmt.Sprintf("-%d", ri.Deletions)
+	}()
+}
+
+/*
+	printf "%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n" \
+	  "${branch}${state}" \
+	  "${remote}" \
+	  "${remote_url}" \
+	  "${upstream}" \
+	  "${num_staged}" \
+	  "${num_conflicts}" \
+	  "${num_changed}" \
+	  "${num_untracked}" \
+	  "${num_stashed}" \
+	  "${clean}"
+*/
+
+// FmtRaw outputs parsable status (line-delimited)
+func (ri *RepoInfo) FmtRaw() string {
+	return fmt.Sprintf("%v\n%v\n%v\n%v\n%v\n%d\n%v\n%v\n%v\n%v\n%v\n%v\n%v",
+		ri.Branch,
+		ri.fmtRemote(),
+		".",
+		ri.fmtUpstream(),
+		ri.Staged.Modified,
+		ri.Unmerged,
+		ri.Unstaged.Modified,
+		ri.Untracked,
+		ri.Stashes,
+		func() int8 {
+			if ri.Unstaged.HasChanged() {
+				return 1
+			}
+			return 0
+		}(),
+		ri.Insertions,
+		ri.Deletions,
+		ri.fmtOperation())
+}
+
+// jsonSchemaVersion is bumped on any incompatible change to FmtJSON output
+const jsonSchemaVersion = 1
+
+// FmtFiles outputs one line per changed, unmerged or untracked file
+func (ri *RepoInfo) FmtFiles() string {
+	lines := make([]string, len(ri.Files))
+	for i := range ri.Files {
+		lines[i] = ri.Files[i].String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// FmtJSON outputs status as a single JSON object
+func (ri *RepoInfo) FmtJSON() string {
+	b, err := json.Marshal(struct {
+		SchemaVersion  int                         `json:"schema_version"`
+		WorkingDir     string                      `json:"working_dir"`
+		GitDir         string                      `json:"git_dir"`
+		Branch         string                      `json:"branch"`
+		Commit         string                      `json:"commit"`
+		Remote         string                      `json:"remote"`
+		Upstream       string                      `json:"upstream"`
+		Ahead          int                         `json:"ahead"`
+		Behind         int                         `json:"behind"`
+		Untracked      int                         `json:"untracked"`
+		Unmerged       int                         `json:"unmerged"`
+		Insertions     int                         `json:"insertions"`
+		Deletions      int                         `json:"deletions"`
+		Stashed        bool                        `json:"stashed"`
+		StashCount     int                         `json:"stash_count"`
+		TimedOut       bool                        `json:"timed_out"`
+		Stale          bool                        `json:"stale"`
+		Operation      string                      `json:"operation"`
+		OperationStep  int                         `json:"operation_step"`
+		OperationTotal int                         `json:"operation_total"`
+		Files          []gitstatus.FileStatus      `json:"files,omitempty"`
+		Conflicts      gitstatus.Conflicts         `json:"conflicts"`
+		Submodules     gitstatus.Submodules        `json:"submodules"`
+		SubStatus      []gitstatus.SubmoduleStatus `json:"submodule_status,omitempty"`
+		Staged         gitstatus.GitArea           `json:"staged"`
+		Unstaged       gitstatus.GitArea           `json:"unstaged"`
+	}{
+		SchemaVersion:  jsonSchemaVersion,
+		WorkingDir:     ri.WorkingDir,
+		GitDir:         ri.GitDir,
+		Branch:         ri.Branch,
+		Commit:         ri.Commit,
+		Remote:         ri.Remote,
+		Upstream:       ri.Upstream,
+		Ahead:          ri.Ahead,
+		Behind:         ri.Behind,
+		Untracked:      ri.Untracked,
+		Unmerged:       ri.Unmerged,
+		Insertions:     ri.Insertions,
+		Deletions:      ri.Deletions,
+		Stashed:        ri.Stashes > 0,
+		StashCount:     ri.Stashes,
+		TimedOut:       ri.TimedOut,
+		Stale:          ri.Stale,
+		Operation:      ri.Operation.Name,
+		OperationStep:  ri.Operation.Step,
+		OperationTotal: ri.Operation.Total,
+		Files:          ri.Files,
+		Conflicts:      ri.Conflicts,
+		Submodules:     ri.Submodules,
+		SubStatus:      ri.SubmoduleStatus,
+		Staged:         ri.Staged,
+		Unstaged:       ri.Unstaged,
+	})
+	if err != nil {
+		log.Printf("Error marshaling json: %s", err)
+		return "{}"
+	}
+	return string(b)
+}
+
+// collectOptions returns the options for gitstatus.Collect implied
+// by the command line and format string
+func collectOptions() gitstatus.Options {
+	return gitstatus.Options{
+		NoGitTag:    options.NoGitTag,
+		Diff:        options.ShowDiff && !options.HideDiff,
+		Stash:       options.ShowStash,
+		Operation:   options.ShowOperation,
+		GitDir:      options.ShowGitDir,
+		Submodules:  options.RecurseSubmodules,
+		SkipStatus:  options.Output == "string" && !options.Files && !options.needsStatus(),
+		Backend:     backend(options.Backend),
+		NoUntracked: options.HideUntracked,
+	}
+}
+
+// run collects repo info from the daemon if it is running, or the disk
+// cache if enabled and fresh, otherwise directly, stopping early if
+// ctx expires. Whatever was gathered before the deadline is returned.
+// In async mode, cached info is returned even if stale.
+func run(ctx context.Context) *RepoInfo {
+	opts := collectOptions()
+	dir, err := filepath.Abs(cwd)
+	if err != nil {
+		dir = cwd
+	}
+	st, err := queryDaemon(ctx, options.Socket, daemonRequest{Dir: dir, Timeout: options.Timeout, Options: opts})
+	if err == nil {
+		return &RepoInfo{Status: st}
+	}
+	log.Printf("Daemon not available: %s", err)
+
+	if options.Async {
+		if ri := runAsync(dir, opts); ri != nil {
+			return ri
+		}
+	}
+
+	var cache *statusCache
+	if options.Cache {
+		if cache, err = openCache(dir, opts); err != nil {
+			log.Printf("Cannot open status cache: %s", err)
+		} else if st, fresh := cache.load(options.CacheMaxAge); fresh {
+			log.Printf("Using cached status from %s", cache.path)
+			st.WorkingDir = cwd
+			return &RepoInfo{Status: st}
+		}
+	}
+
+	opts.Logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	if st, err = gitstatus.Collect(ctx, cwd, opts); err != nil {
+		log.Printf("Git status error: %s", err)
+		os.Exit(1)
+	}
+	if cache != nil && !st.TimedOut {
+		if err := cache.store(st); err != nil {
+			log.Printf("Error writing status cache: %s", err)
+		}
+	}
+	return &RepoInfo{Status: st}
+}
+
+// backend returns the status backend named on the command line
+func backend(name string) gitstatus.Backend {
+	if name == gitstatus.BackendNative.String() {
+		return gitstatus.BackendNative
+	}
+	return gitstatus.BackendGit
+}
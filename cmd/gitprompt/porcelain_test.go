@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/comfortablynick/gitprompt/gitstatus"
+)
+
+// gitoutput is converted to the NUL-delimited form of `git status -z`
+var gitoutput = strings.NewReplacer("\n", "\x00", "\t", "\x00").Replace(`
+# branch.oid 51c9c58e2175b768137c1e38865f394c76a7d49d
+# branch.head master
+# branch.upstream origin/master
+# branch.ab +1 -10
+1 .M N... 100644 100644 100644 3e2ceb914cf9be46bf235432781840f4145363fd 3e2ceb914cf9be46bf235432781840f4145363fd Gopkg.lock
+1 .M N... 100644 100644 100644 cecb683e6e626bcba909ddd36d3357d49f0cfd09 cecb683e6e626bcba909ddd36d3357d49f0cfd09 Gopkg.toml
+1 .M N... 100644 100644 100644 aea984b7df090ce3a5826a854f3e5364cd8f2ccd aea984b7df090ce3a5826a854f3e5364cd8f2ccd porcelain.go
+1 .D N... 100644 100644 000000 6d9532ba55b84ec4faf214f9cdb9ce70ec8f4f5b 6d9532ba55b84ec4faf214f9cdb9ce70ec8f4f5b porcelain_test.go
+2 R. N... 100644 100644 100644 44d0a25072ee3706a8015bef72bdd2c4ab6da76d 44d0a25072ee3706a8015bef72bdd2c4ab6da76d R100 hm.rb	hw.rb
+u UU N... 100644 100644 100644 100644 ac51efdc3df4f4fd328d1a02ad05331d8e2c9111 36c06c8752c78d2aff89571132f3bf7841a7b5c3 e85207e04dfdd5eb0a1e9febbc67fd837c44a1cd hw.rb
+? _porcelain_test.go
+? git.go
+? git_test.go
+? goreleaser.yml
+? vendor/
+`)
+
+const expectedFmtOutput = ` [91mmaster[0m@[91m51c9c58[0m  ↑1  ↓10  ?‼Δ ✘ `
+
+func TestFmtOutput(t *testing.T) {
+	var ri = &RepoInfo{Status: new(gitstatus.Status)}
+	if err := ri.Parse(strings.NewReader(gitoutput)); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := ri.Fmt(); out != expectedFmtOutput {
+		t.Logf("\nexpected:\n%s\ngot:\n%s\n", expectedFmtOutput, out)
+		t.FailNow()
+	}
+}
+
+func TestFmtJSON(t *testing.T) {
+	var ri = &RepoInfo{Status: new(gitstatus.Status)}
+	if err := ri.Parse(strings.NewReader(gitoutput)); err != nil {
+		t.Fatal(err)
+	}
+
+	var out struct {
+		SchemaVersion int    `json:"schema_version"`
+		Branch        string `json:"branch"`
+		Upstream      string `json:"upstream"`
+		Ahead         int    `json:"ahead"`
+		Behind        int    `json:"behind"`
+		Untracked     int    `json:"untracked"`
+		Unmerged      int    `json:"unmerged"`
+		Files         []struct {
+			XY       string `json:"xy"`
+			Path     string `json:"path"`
+			OrigPath string `json:"orig_path"`
+		} `json:"files"`
+		Staged   map[string]int `json:"staged"`
+		Unstaged map[string]int `json:"unstaged"`
+	}
+	if err := json.Unmarshal([]byte(ri.FmtJSON()), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.SchemaVersion != jsonSchemaVersion || out.Branch != "master" || out.Upstream != "origin/master" ||
+		out.Ahead != 1 || out.Behind != 10 || out.Untracked != 5 || out.Unmerged != 1 {
+		t.Errorf("unexpected json output: %+v", out)
+	}
+	if len(out.Files) != 11 || out.Files[4].Path != "hm.rb" || out.Files[4].OrigPath != "hw.rb" {
+		t.Errorf("unexpected files: %+v", out.Files)
+	}
+	if out.Staged["renamed"] != 1 || out.Unstaged["modified"] != 3 || out.Unstaged["deleted"] != 1 {
+		t.Errorf("unexpected staged/unstaged: %v %v", out.Staged, out.Unstaged)
+	}
+}
+
+func TestFmtTimedOut(t *testing.T) {
+	defer func(old Options, format groupNode) { options, promptFormat = old, format }(options, promptFormat)
+	options.Shell = "none"
+
+	// git was killed before it printed the branch and commit
+	var err error
+	if promptFormat, err = parseFormat("%b@%c %m"); err != nil {
+		t.Fatal(err)
+	}
+	ri := &RepoInfo{Status: &gitstatus.Status{TimedOut: true}}
+	if out, want := ri.fmtString(), "@  "+paint("timeout", glyphs["timeout"]); out != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+}
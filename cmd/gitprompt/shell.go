@@ -0,0 +1,108 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ansiEscape matches SGR color sequences as written by fatih/color
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// shellVar is a single variable assignment for shell output
+type shellVar struct {
+	name  string
+	value string
+}
+
+// shellVars returns repo info as an ordered list of shell variables
+func (ri *RepoInfo) shellVars() []shellVar {
+	return []shellVar{
+		{"BRANCH", ri.Branch},
+		{"COMMIT", ri.Commit},
+		{"REMOTE", ri.Remote},
+		{"UPSTREAM", ri.Upstream},
+		{"AHEAD", strconv.Itoa(ri.Ahead)},
+		{"BEHIND", strconv.Itoa(ri.Behind)},
+		{"STAGED", strconv.Itoa(ri.Staged.Count())},
+		{"UNSTAGED", strconv.Itoa(ri.Unstaged.Count())},
+		{"UNTRACKED", strconv.Itoa(ri.Untracked)},
+		{"UNMERGED", strconv.Itoa(ri.Unmerged)},
+		{"CONFLICTS_BOTH_DELETED", strconv.Itoa(ri.Conflicts.BothDeleted)},
+		{"CONFLICTS_ADDED_BY_US", strconv.Itoa(ri.Conflicts.AddedByUs)},
+		{"CONFLICTS_DELETED_BY_THEM", strconv.Itoa(ri.Conflicts.DeletedByThem)},
+		{"CONFLICTS_ADDED_BY_THEM", strconv.Itoa(ri.Conflicts.AddedByThem)},
+		{"CONFLICTS_DELETED_BY_US", strconv.Itoa(ri.Conflicts.DeletedByUs)},
+		{"CONFLICTS_BOTH_ADDED", strconv.Itoa(ri.Conflicts.BothAdded)},
+		{"CONFLICTS_BOTH_MODIFIED", strconv.Itoa(ri.Conflicts.BothModified)},
+		{"SUBMODULES_NEW_COMMITS", strconv.Itoa(ri.Submodules.NewCommits)},
+		{"SUBMODULES_MODIFIED", strconv.Itoa(ri.Submodules.Modified)},
+		{"SUBMODULES_UNTRACKED", strconv.Itoa(ri.Submodules.Untracked)},
+		{"INSERTIONS", strconv.Itoa(ri.Insertions)},
+		{"DELETIONS", strconv.Itoa(ri.Deletions)},
+		{"STASHED", strconv.Itoa(ri.Stashes)},
+		{"OPERATION", ri.Operation.Name},
+		{"OPERATION_STEP", strconv.Itoa(ri.Operation.Step)},
+		{"OPERATION_TOTAL", strconv.Itoa(ri.Operation.Total)},
+		{"TIMED_OUT", strconv.Itoa(btoi(ri.TimedOut))},
+		{"STALE", strconv.Itoa(btoi(ri.Stale))},
+		{"GIT_DIR", ri.GitDir},
+	}
+}
+
+// FmtShell outputs GITPROMPT_* variable assignments that can be
+// eval'd by the given shell (sh, zsh or fish)
+func (ri *RepoInfo) FmtShell(shell string) string {
+	var b strings.Builder
+	for _, v := range ri.shellVars() {
+		switch shell {
+		case "fish":
+			b.WriteString("set -g GITPROMPT_" + v.name + " " + quoteFish(v.value) + ";\n")
+		default:
+			b.WriteString("GITPROMPT_" + v.name + "=" + quotePosix(v.value) + ";\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// quotePosix single-quotes s for sh/bash/zsh
+func quotePosix(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// quoteFish single-quotes s for fish, which allows \' and \\ escapes
+func quoteFish(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+// promptEscape makes s safe to embed in the prompt of the given shell.
+// Color sequences are wrapped in the shell's zero-width markers so line
+// length is computed correctly, and prompt metacharacters are escaped.
+//
+// For bash the markers are only interpreted if the output is assigned to
+// PS1 (e.g. in PROMPT_COMMAND) rather than called with $(...) inside PS1.
+// Bash expands PS1 again with promptvars on, so "$" and "`" in branch or
+// remote names are escaped too; bash shows "\$" as "#" for root.
+//
+// For zsh the output must not be expanded again under prompt_subst: call
+// it from a single-quoted PROMPT='$(gitprompt -shell zsh)', which zsh
+// does not rescan, never PROMPT="$(gitprompt -shell zsh)".
+func promptEscape(s, shell string) string {
+	var start, end string
+	switch shell {
+	case "bash":
+		s = strings.Replace(s, `\`, `\\`, -1)
+		s = strings.Replace(s, "$", `\$`, -1)
+		s = strings.Replace(s, "`", "\\`", -1)
+		start, end = `\[`, `\]`
+	case "zsh", "tcsh":
+		s = strings.Replace(s, "%", "%%", -1)
+		start, end = "%{", "%}"
+	default:
+		return s
+	}
+	return ansiEscape.ReplaceAllStringFunc(s, func(seq string) string {
+		return start + seq + end
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/comfortablynick/gitprompt/gitstatus"
+	"github.com/fatih/color"
+)
+
+func TestQuoteShell(t *testing.T) {
+	tests := []struct {
+		in, posix, fish string
+	}{
+		{"master", `'master'`, `'master'`},
+		{"", `''`, `''`},
+		{"it's a branch", `'it'\''s a branch'`, `'it\'s a branch'`},
+		{`back\slash $HOME`, `'back\slash $HOME'`, `'back\\slash $HOME'`},
+	}
+	for _, tt := range tests {
+		if out := quotePosix(tt.in); out != tt.posix {
+			t.Errorf("quotePosix(%q): expected %s, got %s", tt.in, tt.posix, out)
+		}
+		if out := quoteFish(tt.in); out != tt.fish {
+			t.Errorf("quoteFish(%q): expected %s, got %s", tt.in, tt.fish, out)
+		}
+	}
+}
+
+func TestFmtShell(t *testing.T) {
+	var ri = &RepoInfo{Status: new(gitstatus.Status)}
+	if err := ri.Parse(strings.NewReader(gitoutput)); err != nil {
+		t.Fatal(err)
+	}
+
+	out := ri.FmtShell("sh")
+	for _, want := range []string{
+		"GITPROMPT_BRANCH='master';",
+		"GITPROMPT_UPSTREAM='origin/master';",
+		"GITPROMPT_BEHIND='10';",
+		"GITPROMPT_UNSTAGED='4';",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if out := ri.FmtShell("fish"); !strings.HasPrefix(out, "set -g GITPROMPT_BRANCH 'master';") {
+		t.Errorf("unexpected fish output:\n%s", out)
+	}
+}
+
+func TestPromptEscape(t *testing.T) {
+	const in = "\x1b[91m100%\x1b[0m a\\b"
+	tests := []struct {
+		shell, expected string
+	}{
+		{"none", in},
+		{"fish", in},
+		{"bash", "\\[\x1b[91m\\]100%\\[\x1b[0m\\] a\\\\b"},
+		{"zsh", "%{\x1b[91m%}100%%%{\x1b[0m%} a\\b"},
+		{"tcsh", "%{\x1b[91m%}100%%%{\x1b[0m%} a\\b"},
+	}
+	for _, tt := range tests {
+		if out := promptEscape(in, tt.shell); out != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.shell, tt.expected, out)
+		}
+	}
+}
+
+func TestPromptEscapeBranch(t *testing.T) {
+	defer func(old bool) { color.NoColor = old }(color.NoColor)
+	color.NoColor = false
+
+	// A branch name must not run commands when bash expands PS1 again
+	ri := &RepoInfo{Status: &gitstatus.Status{Branch: "$(x)`y`"}}
+	out := promptEscape(ri.fmtCleanDirty(paint, ri.Branch), "bash")
+	want := "\\[\x1b[92m\\]\\$(x)\\`y\\`\\[\x1b[0m\\]"
+	if out != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+}
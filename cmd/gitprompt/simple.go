@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os/exec"
 	"strings"
+
+	"github.com/comfortablynick/gitprompt/gitstatus"
 )
 
 func parseSimple(status string) error {
@@ -17,10 +20,10 @@ func parseSimple(status string) error {
 	return nil
 }
 
-func runSimple() error {
+func runSimple(ctx context.Context) error {
 	log.Println("Running simple mode")
 	status_cmd := []string{"status", "--porcelain", "--branch", "--untracked-files=normal"}
-	cmd := exec.Command(gitExe, status_cmd...)
+	cmd := exec.CommandContext(ctx, gitstatus.GitExe, status_cmd...)
 	out, err := cmd.Output()
 	if err != nil {
 		fmt.Println(err)
@@ -0,0 +1,68 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// checkSocket returns an error unless the daemon socket can be trusted:
+// its dir must belong to the current user and be writable only by them,
+// and the socket, if it exists, must belong to them and be closed to
+// other users. Otherwise another user could answer in the daemon's place.
+func checkSocket(socket string) error {
+	dir := filepath.Dir(socket)
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a dir", dir)
+	}
+	if err := checkOwner(dir, fi); err != nil {
+		return err
+	}
+	if fi.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s is writable by other users", dir)
+	}
+
+	fi, err = os.Lstat(socket)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s is not a socket", socket)
+	}
+	if err := checkOwner(socket, fi); err != nil {
+		return err
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s is accessible by other users", socket)
+	}
+	return nil
+}
+
+// checkOwner returns an error unless the file described by fi belongs
+// to the current user
+func checkOwner(path string, fi os.FileInfo) error {
+	if st, ok := fi.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not owned by the current user", path)
+	}
+	return nil
+}
+
+// listenPrivate listens on socket, creating it with mode 0600 so no
+// other user can connect, even briefly
+func listenPrivate(socket string) (net.Listener, error) {
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", socket)
+}
@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// checkSocket fails, as socket ownership cannot be checked, so prompts
+// always collect status themselves
+func checkSocket(socket string) error {
+	return errors.New("daemon is not supported on windows")
+}
+
+// listenPrivate is not supported, see checkSocket
+func listenPrivate(socket string) (net.Listener, error) {
+	return nil, errors.New("daemon is not supported on windows")
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// theme maps each part of the prompt to a color spec, see parseColor
+type theme map[string]string
+
+// themes are the built-in color schemes, selected with --theme. Every
+// theme sets the same parts; the config file may override any of them.
+var themes = map[string]theme{
+	"default": {
+		"branch_clean":  "higreen",
+		"branch_staged": "hiyellow",
+		"branch_dirty":  "hired",
+		"ahead":         "yellow",
+		"behind":        "yellow",
+		"untracked":     "hiyellow",
+		"unstaged":      "hired",
+		"staged":        "green",
+		"diff":          "hired",
+		"stash":         "",
+		"conflicts":     "hired",
+		"submodules":    "cyan",
+		"operation":     "magenta",
+		"timeout":       "hired",
+		"stale":         "hiblack",
+	},
+	// mono uses attributes only, for terminals with odd palettes
+	"mono": {
+		"branch_clean":  "bold",
+		"branch_staged": "bold",
+		"branch_dirty":  "bold,underline",
+		"ahead":         "",
+		"behind":        "",
+		"untracked":     "italic",
+		"unstaged":      "underline",
+		"staged":        "bold",
+		"diff":          "",
+		"stash":         "",
+		"conflicts":     "reverse",
+		"submodules":    "",
+		"operation":     "bold",
+		"timeout":       "reverse",
+		"stale":         "faint",
+	},
+	// gruvbox uses the 256 color palette
+	"gruvbox": {
+		"branch_clean":  "142",
+		"branch_staged": "214",
+		"branch_dirty":  "167",
+		"ahead":         "108",
+		"behind":        "175",
+		"untracked":     "109",
+		"unstaged":      "167",
+		"staged":        "142",
+		"diff":          "208",
+		"stash":         "175",
+		"conflicts":     "167,bold",
+		"submodules":    "109",
+		"operation":     "175",
+		"timeout":       "167",
+		"stale":         "245",
+	},
+	// solarized uses 24-bit colors, approximated where unsupported
+	"solarized": {
+		"branch_clean":  "#859900",
+		"branch_staged": "#b58900",
+		"branch_dirty":  "#dc322f",
+		"ahead":         "#2aa198",
+		"behind":        "#d33682",
+		"untracked":     "#268bd2",
+		"unstaged":      "#dc322f",
+		"staged":        "#859900",
+		"diff":          "#cb4b16",
+		"stash":         "#6c71c4",
+		"conflicts":     "#dc322f,bold",
+		"submodules":    "#2aa198",
+		"operation":     "#d33682",
+		"timeout":       "#dc322f",
+		"stale":         "#586e75",
+	},
+}
+
+// useTheme sets colors to the named built-in theme
+func useTheme(name string) error {
+	t, ok := themes[name]
+	if !ok {
+		var names []string
+		for name := range themes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown theme `%s', expected one of: %s", name, strings.Join(names, ", "))
+	}
+	colors = t.copy()
+	return nil
+}
+
+func (t theme) copy() theme {
+	cp := make(theme, len(t))
+	for part, spec := range t {
+		cp[part] = spec
+	}
+	return cp
+}
+
+// trueColor is set if the terminal supports 24-bit color; otherwise
+// hex colors are shown as the closest color in the 256 color palette
+var trueColor = os.Getenv("COLORTERM") == "truecolor" || os.Getenv("COLORTERM") == "24bit"
+
+// colorAttrs are the names allowed in a color spec
+var colorAttrs = map[string]color.Attribute{
+	"black":     color.FgBlack,
+	"red":       color.FgRed,
+	"green":     color.FgGreen,
+	"yellow":    color.FgYellow,
+	"blue":      color.FgBlue,
+	"magenta":   color.FgMagenta,
+	"cyan":      color.FgCyan,
+	"white":     color.FgWhite,
+	"hiblack":   color.FgHiBlack,
+	"hired":     color.FgHiRed,
+	"higreen":   color.FgHiGreen,
+	"hiyellow":  color.FgHiYellow,
+	"hiblue":    color.FgHiBlue,
+	"himagenta": color.FgHiMagenta,
+	"hicyan":    color.FgHiCyan,
+	"hiwhite":   color.FgHiWhite,
+	"bold":      color.Bold,
+	"faint":     color.Faint,
+	"italic":    color.Italic,
+	"underline": color.Underline,
+	"reverse":   color.ReverseVideo,
+}
+
+// parseColor parses a color spec: comma or space separated colors and
+// attributes. A color is a name from colorAttrs, a 256 color palette
+// index or a "#rrggbb" hex color, prefixed by "bg:" for the background,
+// ex: "hiyellow,bold", "black bg:208", "#859900". An empty spec means
+// no color.
+func parseColor(spec string) (*color.Color, error) {
+	words := strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(words) == 0 {
+		return nil, nil
+	}
+	c := color.New()
+	for _, w := range words {
+		attrs, err := parseColorWord(w)
+		if err != nil {
+			return nil, err
+		}
+		c.Add(attrs...)
+	}
+	return c, nil
+}
+
+// parseColorWord returns the SGR parameters for a single word of a
+// color spec. Extended colors take several parameters, ex: 38;5;208.
+func parseColorWord(w string) ([]color.Attribute, error) {
+	name := strings.TrimPrefix(w, "bg:")
+	bg := name != w
+	invalid := fmt.Errorf("invalid color `%s'", w)
+
+	if attr, ok := colorAttrs[name]; ok {
+		if !bg {
+			return []color.Attribute{attr}, nil
+		}
+		if attr < color.FgBlack || attr > color.FgHiWhite {
+			return nil, invalid
+		}
+		// Background colors are offset from foreground by 10
+		return []color.Attribute{attr + color.BgBlack - color.FgBlack}, nil
+	}
+
+	extended := color.Attribute(38)
+	if bg {
+		extended = 48
+	}
+	if strings.HasPrefix(name, "#") {
+		rgb, err := strconv.ParseUint(name[1:], 16, 32)
+		if err != nil || len(name) != 7 {
+			return nil, invalid
+		}
+		r, g, b := uint8(rgb>>16), uint8(rgb>>8), uint8(rgb)
+		if !trueColor {
+			return []color.Attribute{extended, 5, color.Attribute(rgbTo256(r, g, b))}, nil
+		}
+		return []color.Attribute{extended, 2, color.Attribute(r), color.Attribute(g), color.Attribute(b)}, nil
+	}
+	if n, err := strconv.ParseUint(name, 10, 8); err == nil {
+		return []color.Attribute{extended, 5, color.Attribute(n)}, nil
+	}
+	return nil, invalid
+}
+
+// rgbTo256 returns the closest color in the 6x6x6 cube or grayscale
+// ramp of the 256 color palette
+func rgbTo256(r, g, b uint8) int {
+	levels := [6]int{0, 95, 135, 175, 215, 255}
+	cube := func(v uint8) int {
+		switch {
+		case v < 48:
+			return 0
+		case v < 115:
+			return 1
+		}
+		return (int(v) - 35) / 40
+	}
+	dist := func(r2, g2, b2 int) int {
+		dr, dg, db := int(r)-r2, int(g)-g2, int(b)-b2
+		return dr*dr + dg*dg + db*db
+	}
+	ri, gi, bi := cube(r), cube(g), cube(b)
+
+	// The grayscale ramp runs from 8 to 238 in steps of 10
+	gray := ((int(r)+int(g)+int(b))/3 - 3) / 10
+	if gray < 0 {
+		gray = 0
+	} else if gray > 23 {
+		gray = 23
+	}
+	level := 8 + 10*gray
+	if dist(level, level, level) < dist(levels[ri], levels[gi], levels[bi]) {
+		return 232 + gray
+	}
+	return 16 + 36*ri + 6*gi + bi
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestThemes(t *testing.T) {
+	for name, th := range themes {
+		if len(th) != len(themes["default"]) {
+			t.Errorf("theme %s sets %d parts, default sets %d", name, len(th), len(themes["default"]))
+		}
+		for part, spec := range th {
+			if _, ok := themes["default"][part]; !ok {
+				t.Errorf("theme %s sets unknown part %s", name, part)
+			}
+			if _, err := parseColor(spec); err != nil {
+				t.Errorf("theme %s: %s: %s", name, part, err)
+			}
+		}
+	}
+
+	defer func(old theme) { colors = old }(colors)
+	if err := useTheme("gruvbox"); err != nil || colors["branch_dirty"] != "167" {
+		t.Errorf("theme not applied: %v %v", err, colors)
+	}
+	if err := useTheme("neon"); err == nil {
+		t.Error("expected error for unknown theme")
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	defer func(old bool) { trueColor = old }(trueColor)
+
+	for _, tt := range []struct {
+		spec      string
+		trueColor bool
+		want      string
+	}{
+		{"hiyellow, bold bg:blue", false, "\x1b[93;1;44mx\x1b[0m"},
+		{"208 bg:236", false, "\x1b[38;5;208;48;5;236mx\x1b[0m"},
+		{"#859900", true, "\x1b[38;2;133;153;0mx\x1b[0m"},
+		{"#859900", false, "\x1b[38;5;100mx\x1b[0m"},
+		{"bg:#808080", false, "\x1b[48;5;244mx\x1b[0m"},
+	} {
+		trueColor = tt.trueColor
+		c, err := parseColor(tt.spec)
+		if err != nil {
+			t.Errorf("%s: %s", tt.spec, err)
+			continue
+		}
+		c.EnableColor()
+		if out := c.Sprint("x"); out != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.spec, tt.want, out)
+		}
+	}
+
+	if c, err := parseColor(""); c != nil || err != nil {
+		t.Errorf("expected no color for empty spec, got %v %v", c, err)
+	}
+	for _, spec := range []string{"chartreuse", "bg:bold", "256", "#12345", "#gggggg"} {
+		if _, err := parseColor(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
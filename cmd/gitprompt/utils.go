@@ -4,14 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
-	"strings"
 )
 
 // PrettyPrint prints objects in a readable format for debugging
 func PrettyPrint(v interface{}) (err error) {
 	b, err := json.MarshalIndent(v, "", "  ")
 	if err == nil {
-		fmt.Sprint(string(b))
+		fmt.Println(string(b))
 	}
 	return
 }
@@ -21,7 +20,10 @@ func detent(s string) string {
 	return regexp.MustCompile("(?m)^[\t]*").ReplaceAllString(s, "")
 }
 
-// standardizeSpaces removes extra spaces and trims string
-func standardizeSpaces(s string) string {
-	return strings.Join(strings.Fields(s), " ")
+// btoi converts bool to 1 or 0
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,222 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF |
+	syscall.IN_ONLYDIR
+
+// watcher reports changes to watched repos using inotify
+type watcher struct {
+	fd       int
+	onChange func(root string)
+
+	mu    sync.Mutex
+	dirs  map[int32][]watchedDir // by watch descriptor
+	roots map[string][]int32     // watch descriptors by work tree
+}
+
+// watchedDir is a dir watched on behalf of the repo at root. Nested
+// repos can share a dir, so a descriptor may have several.
+type watchedDir struct {
+	root    string
+	path    string
+	recurse bool // watch subdirs created later
+	gitDir  bool // inside a git dir, where lock files are ignored
+}
+
+func newWatcher(onChange func(root string)) (*watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &watcher{
+		fd:       fd,
+		onChange: onChange,
+		dirs:     make(map[int32][]watchedDir),
+		roots:    make(map[string][]int32),
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+// gitDirTrees are the dirs of a git dir watched with all their subdirs.
+// Reflogs in logs/ are the only record of the stash below its top entry.
+var gitDirTrees = []string{"refs", "logs"}
+
+// watch adds watches for every dir of the work tree at root, and for
+// the top, refs and logs of each git dir. If the watch limit is reached,
+// the watches added so far are removed and an error is returned.
+func (w *watcher) watch(root string, gitDirs ...string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.addTree(watchedDir{root: root, path: root, recurse: true})
+	seen := make(map[string]bool)
+	for _, dir := range gitDirs {
+		if err != nil || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		// HEAD, index, packed-refs and operation state are at the top
+		err = w.add(watchedDir{root: root, path: dir, gitDir: true})
+		for _, tree := range gitDirTrees {
+			if err == nil {
+				err = w.addTree(watchedDir{root: root, path: filepath.Join(dir, tree), recurse: true, gitDir: true})
+			}
+		}
+	}
+	if err != nil {
+		w.unwatchLocked(root)
+	}
+	return err
+}
+
+// addTree watches dir and its subdirs, skipping nested git dirs
+func (w *watcher) addTree(dir watchedDir) error {
+	return filepath.Walk(dir.path, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		if path != dir.path && fi.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		sub := dir
+		sub.path = path
+		return w.add(sub)
+	})
+}
+
+// add watches a single dir. Dirs removed before they could be
+// watched are not an error.
+func (w *watcher) add(dir watchedDir) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir.path, watchMask)
+	if err != nil {
+		if err == syscall.ENOENT || err == syscall.ENOTDIR || err == syscall.EACCES {
+			return nil
+		}
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	id := int32(wd)
+	for _, d := range w.dirs[id] {
+		if d.root == dir.root {
+			return nil
+		}
+	}
+	w.dirs[id] = append(w.dirs[id], dir)
+	w.roots[dir.root] = append(w.roots[dir.root], id)
+	return nil
+}
+
+// watching reports whether the repo at root is still fully watched
+func (w *watcher) watching(root string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.roots[root]) > 0
+}
+
+// unwatch removes every watch added for the repo at root
+func (w *watcher) unwatch(root string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.unwatchLocked(root)
+}
+
+func (w *watcher) unwatchLocked(root string) {
+	for _, id := range w.roots[root] {
+		var keep []watchedDir
+		for _, d := range w.dirs[id] {
+			if d.root != root {
+				keep = append(keep, d)
+			}
+		}
+		if len(keep) > 0 {
+			w.dirs[id] = keep
+			continue
+		}
+		delete(w.dirs, id)
+		syscall.InotifyRmWatch(w.fd, uint32(id)) // #nosec: may already be gone
+	}
+	delete(w.roots, root)
+}
+
+// isGitDirTree reports whether name is one of gitDirTrees
+func isGitDirTree(name string) bool {
+	for _, tree := range gitDirTrees {
+		if name == tree {
+			return true
+		}
+	}
+	return false
+}
+
+// readEvents calls onChange once for each repo changed by a batch of events
+func (w *watcher) readEvents() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := syscall.Read(w.fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || n <= 0 {
+			return
+		}
+		changed := make(map[string]bool)
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off])) // #nosec
+			start := off + syscall.SizeofInotifyEvent
+			off = start + int(ev.Len)
+			name := strings.TrimRight(string(buf[start:off]), "\x00")
+			w.handleEvent(ev.Wd, ev.Mask, name, changed)
+		}
+		for root := range changed {
+			w.onChange(root)
+		}
+	}
+}
+
+// handleEvent records which repos an event changes, and watches
+// new subdirs of recursively watched dirs
+func (w *watcher) handleEvent(wd int32, mask uint32, name string, changed map[string]bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// Events were dropped, so any repo may have changed
+		for root := range w.roots {
+			changed[root] = true
+		}
+		return
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		return
+	}
+	for _, d := range w.dirs[wd] {
+		if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 &&
+			(d.recurse && name != ".git" || d.gitDir && !d.recurse && isGitDirTree(name)) {
+			// logs/ is only created by the first commit or stash
+			sub := d
+			sub.path, sub.recurse = filepath.Join(d.path, name), true
+			if err := w.addTree(sub); err != nil {
+				// Out of watches; stop caching rather than serve stale status
+				defer w.unwatchLocked(d.root)
+			}
+		}
+		// Lock files come and go on every `git status` without changing anything
+		if d.gitDir && strings.HasSuffix(name, ".lock") {
+			continue
+		}
+		changed[d.root] = true
+	}
+}
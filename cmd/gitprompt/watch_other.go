@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// watcher is not implemented outside Linux, so the daemon cannot
+// tell when cached status goes stale
+type watcher struct{}
+
+func newWatcher(onChange func(root string)) (*watcher, error) {
+	return nil, fmt.Errorf("daemon is not supported on %s", runtime.GOOS)
+}
+
+func (w *watcher) watch(root string, gitDirs ...string) error {
+	return fmt.Errorf("file watching is not supported on %s", runtime.GOOS)
+}
+
+func (w *watcher) unwatch(root string) {}
+
+func (w *watcher) watching(root string) bool { return false }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Truncation strategies, given between the width and verb of a
+// format verb, ex: %20=b
+const (
+	truncEnd    = 0   // "feature/JIRA-1234…", the default
+	truncStart  = '<' // "…some-description"
+	truncMiddle = '=' // "feature/J…cription"
+	truncPath   = '/' // "f/JIRA-12345-some…", shortening dirs first
+)
+
+// wideRanges are the ranges of runes shown two columns wide: East Asian
+// wide and fullwidth characters, and emoji shown as pictures by default
+var wideRanges = []struct{ lo, hi rune }{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec},
+	{0x23f0, 0x23f0}, {0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267f, 0x267f}, {0x2693, 0x2693}, {0x26a1, 0x26a1},
+	{0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5}, {0x26ce, 0x26ce},
+	{0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5},
+	{0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b},
+	{0x2728, 0x2728}, {0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27b0, 0x27b0}, {0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x2e80, 0x303e},
+	{0x3041, 0x33ff}, {0x3400, 0x4dbf}, {0x4e00, 0x9fff}, {0xa000, 0xa4cf},
+	{0xa960, 0xa97f}, {0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f}, {0xff00, 0xff60}, {0xffe0, 0xffe6}, {0x1f004, 0x1f004},
+	{0x1f0cf, 0x1f0cf}, {0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a}, {0x1f200, 0x1f251},
+	{0x1f300, 0x1f64f}, {0x1f680, 0x1f6ff}, {0x1f900, 0x1f9ff}, {0x1fa70, 0x1faff},
+	{0x20000, 0x3fffd},
+}
+
+// runeWidth returns the number of columns a terminal uses to show r
+func runeWidth(r rune) int {
+	if r == 0 || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) || unicode.IsControl(r) {
+		return 0
+	}
+	for _, w := range wideRanges {
+		if r < w.lo {
+			break
+		}
+		if r <= w.hi {
+			return 2
+		}
+	}
+	return 1
+}
+
+// cell is a piece of rendered text: a rune, or a color escape sequence,
+// which takes no space
+type cell struct {
+	text  string
+	width int
+	esc   bool
+}
+
+// cells splits s into runes and SGR escape sequences
+func cells(s string) []cell {
+	var out []cell
+	for len(s) > 0 {
+		if loc := ansiEscape.FindStringIndex(s); loc != nil && loc[0] == 0 {
+			out = append(out, cell{text: s[:loc[1]], esc: true})
+			s = s[loc[1]:]
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(s)
+		out = append(out, cell{text: s[:n], width: runeWidth(r)})
+		s = s[n:]
+	}
+	return out
+}
+
+// displayWidth returns the number of columns s takes in a terminal,
+// ignoring color escape sequences
+func displayWidth(s string) int {
+	var w int
+	for _, c := range cells(s) {
+		w += c.width
+	}
+	return w
+}
+
+// truncateWidth shortens s to at most width columns, marking the text
+// cut out with the ellipsis glyph. Escape sequences are kept, so text
+// after the cut keeps its color.
+func truncateWidth(s string, width int, strategy rune) string {
+	cs := cells(s)
+	var total int
+	for _, c := range cs {
+		total += c.width
+	}
+	if total <= width {
+		return s
+	}
+	// avail marks the runes left to show after shortening dirs, which
+	// is done first for truncPath, and keep those shown after cutting
+	avail := make([]bool, len(cs))
+	for i := range avail {
+		avail[i] = true
+	}
+	if strategy == truncPath {
+		total = shortenPath(cs, avail)
+		if total <= width {
+			return join(cs, avail, -1)
+		}
+	}
+
+	ellipsis := glyphs["ellipsis"]
+	budget := width - displayWidth(ellipsis)
+	if budget < 0 {
+		ellipsis, budget = "", width
+	}
+
+	// Keep the runes that fit from the start and end, cutting the rest
+	var head, tail int
+	switch strategy {
+	case truncStart:
+		tail = budget
+	case truncMiddle:
+		head = (budget + 1) / 2
+		tail = budget - head
+	default:
+		head = budget
+	}
+	keep := make([]bool, len(cs))
+	cut := -1
+	for i, c := range cs {
+		if c.esc || !avail[i] {
+			continue
+		}
+		if c.width > head {
+			cut = i
+			break
+		}
+		head -= c.width
+		keep[i] = true
+	}
+	for i := len(cs) - 1; i > cut; i-- {
+		if cs[i].esc || !avail[i] {
+			continue
+		}
+		if cs[i].width > tail {
+			break
+		}
+		tail -= cs[i].width
+		keep[i] = true
+	}
+	if cut < 0 {
+		return join(cs, keep, -1)
+	}
+	cs[cut].text = ellipsis
+	return join(cs, keep, cut)
+}
+
+// shortenPath marks all but the first rune of each dir of a path as
+// unavailable, ex: "feature/JIRA-1" to "f/JIRA-1", returning the width
+// left
+func shortenPath(cs []cell, avail []bool) int {
+	last := len(cs)
+	for last > 0 && cs[last-1].text != "/" {
+		last--
+	}
+	first := true
+	for i, c := range cs[:last] {
+		switch {
+		case c.esc:
+		case c.text == "/":
+			first = true
+		case first:
+			first = false
+		default:
+			avail[i] = false
+		}
+	}
+	var w int
+	for i, c := range cs {
+		if avail[i] {
+			w += c.width
+		}
+	}
+	return w
+}
+
+// join concatenates the kept cells, escape sequences and the cell at
+// index always
+func join(cs []cell, keep []bool, always int) string {
+	var b strings.Builder
+	for i, c := range cs {
+		if keep[i] || c.esc || i == always {
+			b.WriteString(c.text)
+		}
+	}
+	return b.String()
+}
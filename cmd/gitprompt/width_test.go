@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestDisplayWidth(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want int
+	}{
+		{"master", 6},
+		{"⎇ master ↑1", 11},
+		{"功能/登录", 9},
+		{"fix-🐛", 6},
+		{"é", 1},
+		{"\x1b[92mmaster\x1b[0m", 6},
+		{"\x1b[38;5;208m分支\x1b[0m", 4},
+	} {
+		if w := displayWidth(tt.s); w != tt.want {
+			t.Errorf("%q: expected width %d, got %d", tt.s, tt.want, w)
+		}
+	}
+}
+
+func TestTruncateWidth(t *testing.T) {
+	defer func(old glyphSet) { glyphs = old }(glyphs)
+	glyphs = glyphSets["unicode"].copy()
+
+	for _, tt := range []struct {
+		s        string
+		width    int
+		strategy rune
+		want     string
+	}{
+		{"master", 6, truncEnd, "master"},
+		{"feature/JIRA-1234", 10, truncEnd, "feature/J…"},
+		{"feature/JIRA-1234", 10, truncStart, "…JIRA-1234"},
+		{"feature/JIRA-1234", 10, truncMiddle, "featu…1234"},
+		{"feature/JIRA-12345-some-fix", 16, truncPath, "f/JIRA-12345-so…"},
+		{"feature/JIRA-12345", 12, truncPath, "f/JIRA-12345"},
+		{"user/feature/x", 10, truncPath, "u/f/x"},
+		{"功能/登录界面", 7, truncEnd, "功能/…"},
+		{"功能/登录界面", 6, truncStart, "…界面"},
+		{"\x1b[92mfeature/JIRA-1234\x1b[0m", 8, truncEnd, "\x1b[92mfeature…\x1b[0m"},
+		{"master", 1, truncEnd, "…"},
+	} {
+		if out := truncateWidth(tt.s, tt.width, tt.strategy); out != tt.want {
+			t.Errorf("%q to %d%c: expected %q, got %q", tt.s, tt.width, tt.strategy, tt.want, out)
+		}
+		if w := displayWidth(truncateWidth(tt.s, tt.width, tt.strategy)); w > tt.width {
+			t.Errorf("%q to %d%c: width %d is too wide", tt.s, tt.width, tt.strategy, w)
+		}
+	}
+
+	glyphs["ellipsis"] = "..."
+	if out := truncateWidth("master", 2, truncEnd); out != "ma" {
+		t.Errorf("expected ellipsis wider than the width to be left out, got %q", out)
+	}
+}
@@ -0,0 +1,291 @@
+package gitstatus
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+)
+
+// Options selects which data Collect gathers beyond `git status`
+type Options struct {
+	NoGitTag    bool // do not look up a tag name for a detached HEAD
+	Diff        bool // count inserted/deleted lines with `git diff --numstat`, dropped if there are no unstaged changes
+	Stash       bool // count stash entries
+	Operation   bool // detect an in-progress rebase, merge, etc.
+	GitDir      bool // always resolve GitDir, even if nothing else needs it
+	Submodules  bool // run status in each submodule for SubmoduleStatus
+	NoUntracked bool // do not look for untracked files, which is slow in large work trees
+
+	// SkipStatus reads HEAD, refs and config directly instead of running
+	// `git status`. Only branch, commit, remote, upstream, stash and
+	// operation data are filled in; work tree counts and ahead/behind
+	// are left at zero.
+	SkipStatus bool
+
+	// Backend selects how work tree status is read when SkipStatus is
+	// not set. The native backend falls back to git for repos it
+	// cannot read.
+	Backend Backend
+
+	// Logger receives debug messages; nil discards them
+	Logger *log.Logger `json:"-"`
+}
+
+// collector holds the state for a single call to Collect
+type collector struct {
+	dir  string
+	opts Options
+	log  *log.Logger
+	repo *Repo // nil if the repo could not be read natively
+}
+
+// Collect runs `git status` in dir and gathers the data selected by opts.
+// Lookups that do not depend on the output of `git status`, such as the
+// tag, stash count, operation and diff stats, run alongside it, so the
+// total time is bounded by the slowest of them. The diff is cancelled as
+// soon as status finds no unstaged changes.
+//
+// If ctx expires before collection finishes, the data gathered so far is
+// returned with TimedOut set and a nil error. An error is returned only if
+// `git status` itself fails, ex: dir is not inside a git repo; any other
+// lookups still running are then cancelled.
+func Collect(ctx context.Context, dir string, opts Options) (*Status, error) {
+	c := &collector{dir: dir, opts: opts, log: opts.Logger}
+	if c.log == nil {
+		c.log = log.New(ioutil.Discard, "", 0)
+	}
+
+	var st = &Status{WorkingDir: dir}
+
+	var err error
+	if c.repo, err = OpenRepo(dir); err != nil {
+		c.log.Printf("Cannot read repo natively, falling back to git: %s", err)
+		if opts.SkipStatus {
+			return nil, err
+		}
+	} else {
+		st.GitDir = c.repo.GitDir
+	}
+
+	// Reading HEAD directly tells us up front whether a tag lookup is needed
+	var branch, commit string
+	if c.repo != nil {
+		if branch, commit, err = c.repo.Head(); err != nil && opts.SkipStatus {
+			return nil, err
+		}
+	}
+	if opts.SkipStatus {
+		st.Branch, st.Commit = branch, commit
+	}
+
+	// Each lookup writes only its own result, which is merged into st
+	// once all of them are done
+	var (
+		tag     string
+		gitDir  string
+		stashes int
+		op      Operation
+		subs    []SubmoduleStatus
+		numstat string
+	)
+	g := newGroup(ctx)
+	statusDone := make(chan struct{}) // closed once st is filled in
+	if !opts.SkipStatus {
+		g.Go(func(ctx context.Context) error {
+			defer close(statusDone)
+			if opts.Backend == BackendNative && c.repo != nil {
+				return c.runNativeStatus(ctx, st)
+			}
+			return c.runStatus(ctx, st)
+		})
+	}
+	// Without HEAD read up front, the tag is looked up once status
+	// shows HEAD is detached, rather than forking git on every branch
+	tagEarly := !opts.NoGitTag && branch == "(detached)"
+	if tagEarly {
+		g.Go(func(ctx context.Context) error {
+			tag = c.tagForCommit(ctx, commit)
+			return nil
+		})
+	}
+	if opts.Stash || opts.Operation || opts.GitDir {
+		g.Go(func(ctx context.Context) error {
+			var err error
+			if gitDir, err = c.gitDir(ctx); err != nil {
+				c.log.Printf("Error calling PathToGitDir: %s", err)
+				return nil
+			}
+			if opts.Operation {
+				op = readOperation(gitDir)
+			}
+			if opts.Stash {
+				stashes = c.stashCount(gitDir)
+			}
+			return nil
+		})
+	}
+	if opts.Diff && !opts.SkipStatus {
+		g.Go(func(ctx context.Context) error {
+			// A diff is only worth its cost in large repos if there are changes
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go func() {
+				select {
+				case <-statusDone:
+					if !st.Unstaged.HasChanged() {
+						cancel()
+					}
+				case <-ctx.Done():
+				}
+			}()
+			numstat = c.readNumstat(ctx)
+			return nil
+		})
+	}
+	if opts.Submodules {
+		g.Go(func(ctx context.Context) error {
+			var err error
+			if subs, err = c.lookupSubmodules(ctx); err != nil {
+				c.log.Printf("Error reading submodules: %s", err)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	if c.repo != nil && st.Branch != "(detached)" {
+		var upstream string
+		if st.Remote, upstream, err = c.repo.Upstream(st.Branch); err != nil {
+			c.log.Printf("Error reading upstream: %s", err)
+		}
+		if opts.SkipStatus {
+			st.Upstream = upstream
+		}
+	}
+
+	if !opts.NoGitTag && !tagEarly && st.Branch == "(detached)" && ctx.Err() == nil {
+		tag = c.tagForCommit(ctx, st.Commit)
+	}
+	if st.Branch == "(detached)" && tag != "" {
+		st.Branch = tag
+	}
+
+	if st.Unstaged.HasChanged() && numstat != "" {
+		if err := st.parseDiffNumstat(numstat); err != nil {
+			c.log.Printf("Error parsing git diff: %v", err)
+		}
+	}
+
+	if opts.Stash {
+		st.Stashes = stashes
+	}
+	if opts.Operation {
+		st.Operation = op
+	}
+	st.SubmoduleStatus = subs
+	if st.GitDir == "" {
+		st.GitDir = gitDir
+	}
+
+	if ctx.Err() != nil {
+		c.log.Printf("Timed out collecting repo info: %s", ctx.Err())
+		st.TimedOut = true
+	}
+	return st, nil
+}
+
+// runStatus runs `git status` and parses its output into st
+func (c *collector) runStatus(ctx context.Context, st *Status) error {
+	c.log.Printf("Running git status in %s", c.dir)
+	var args []string
+	if c.opts.NoUntracked {
+		args = append(args, "--untracked-files=no")
+	}
+	gitOut, err := GetGitStatusOutput(ctx, c.dir, args...)
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	if err = st.Parse(gitOut); err != nil {
+		// A truncated record is expected if git was killed mid-write
+		if ctx.Err() == nil {
+			return err
+		}
+		c.log.Printf("Error parsing partial git output: %s", err)
+	}
+	return nil
+}
+
+// runNativeStatus reads status with Repo.ReadStatus, falling back
+// to `git status` if the repo uses features it does not support
+func (c *collector) runNativeStatus(ctx context.Context, st *Status) error {
+	c.log.Printf("Reading index and work tree in %s", c.repo.WorkTree)
+	native := &Status{WorkingDir: st.WorkingDir, GitDir: st.GitDir}
+	err := c.repo.readStatus(ctx, native, !c.opts.NoUntracked)
+	if err == nil || ctx.Err() != nil {
+		*st = *native
+		return nil
+	}
+	c.log.Printf("Cannot read status natively, falling back to git: %s", err)
+	return c.runStatus(ctx, st)
+}
+
+// readNumstat returns the output of `git diff --numstat`, empty if
+// it was cancelled
+func (c *collector) readNumstat(ctx context.Context) string {
+	numstat, err := GetGitNumstat(ctx, c.dir)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.log.Printf("Git diff error: %s", err)
+		}
+		return ""
+	}
+	return numstat
+}
+
+// gitDir returns the git dir, reading it natively if possible
+func (c *collector) gitDir(ctx context.Context) (string, error) {
+	if c.repo != nil {
+		return c.repo.GitDir, nil
+	}
+	return PathToGitDir(ctx, c.dir)
+}
+
+// workTree returns the top level of the work tree, reading it natively
+// if possible
+func (c *collector) workTree(ctx context.Context) (string, error) {
+	if c.repo != nil {
+		return c.repo.WorkTree, nil
+	}
+	return PathToWorkTree(ctx, c.dir)
+}
+
+// tagForCommit returns a tag pointing at commit, reading refs
+// natively if possible
+func (c *collector) tagForCommit(ctx context.Context, commit string) string {
+	if c.repo == nil {
+		tag, _ := GetGitTag(ctx, c.dir)
+		return tag
+	}
+	tag, err := c.repo.TagForCommit(commit)
+	if err != nil {
+		c.log.Printf("Error reading tags: %s", err)
+	}
+	return tag
+}
+
+// stashCount returns the number of stash entries by counting
+// lines in the stash reflog
+func (c *collector) stashCount(gitDir string) int {
+	repo := c.repo
+	if repo == nil {
+		repo = &Repo{GitDir: gitDir, CommonDir: gitDir}
+	}
+	n, err := repo.StashCount()
+	if err != nil {
+		c.log.Printf("Error reading stash: %s", err)
+	}
+	return n
+}
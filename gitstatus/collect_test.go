@@ -0,0 +1,99 @@
+package gitstatus
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	f, cleanup := newGitFixture(t)
+	defer cleanup()
+
+	f.write(map[string]string{"a.txt": "one\ntwo\n"})
+	f.commit("initial")
+	f.git("tag", "v1.0")
+	f.write(map[string]string{"a.txt": "one\nthree\nfour\n"})
+	f.git("stash", "-q")
+	f.git("checkout", "-q", "--detach")
+	f.write(map[string]string{"a.txt": "one\n", "new.txt": ""})
+
+	for _, backend := range []Backend{BackendGit, BackendNative} {
+		st, err := Collect(context.Background(), f.dir, Options{
+			Diff:      true,
+			Stash:     true,
+			Operation: true,
+			GitDir:    true,
+			Backend:   backend,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Branch != "v1.0" || st.Stashes != 1 || st.Untracked != 1 || st.Unstaged.Modified != 1 ||
+			st.Insertions != 0 || st.Deletions != 1 || st.GitDir == "" || st.Operation.Name != "" || st.TimedOut {
+			t.Errorf("unexpected status with %s backend: %s", backend, st.Debug(false))
+		}
+
+		st, err = Collect(context.Background(), f.dir, Options{NoUntracked: true, Backend: backend})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Untracked != 0 || st.Unstaged.Modified != 1 {
+			t.Errorf("expected no untracked files with %s backend: %s", backend, st.Debug(false))
+		}
+	}
+
+	if _, err := Collect(context.Background(), f.dir+"/missing", Options{Diff: true, Stash: true}); err == nil {
+		t.Error("expected error collecting outside a repo")
+	}
+}
+
+func TestCollectSubmodules(t *testing.T) {
+	f, cleanup := newGitFixture(t)
+	defer cleanup()
+
+	f.write(map[string]string{
+		"src/a.txt":   "a\n",
+		"lib/b.txt":   "b\n",
+		".gitmodules": "[submodule \"lib\"]\n\tpath = lib\n\turl = ./lib\n",
+	})
+	f.git("-C", "lib", "init", "-q")
+	f.git("-C", "lib", "add", "-A")
+	f.git("-C", "lib", "commit", "-q", "-m", "lib")
+	f.commit("initial")
+	f.write(map[string]string{"lib/b.txt": "changed\n"})
+
+	// .gitmodules is only at the top level
+	for _, dir := range []string{f.dir, filepath.Join(f.dir, "src")} {
+		st, err := Collect(context.Background(), dir, Options{Submodules: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(st.SubmoduleStatus) != 1 || st.SubmoduleStatus[0].Path != "lib" || !st.SubmoduleStatus[0].Dirty {
+			t.Errorf("unexpected submodules from %s: %+v", dir, st.SubmoduleStatus)
+		}
+	}
+}
+
+func TestCollectPackedTag(t *testing.T) {
+	f, cleanup := newGitFixture(t)
+	defer cleanup()
+
+	f.write(map[string]string{"a.txt": "a\n"})
+	f.commit("initial")
+	f.git("tag", "-a", "-m", "release", "v2.0")
+	// Leave the annotated tag object only in a pack, with a loose ref
+	f.git("repack", "-a", "-d", "-q")
+	f.git("prune-packed")
+	f.git("checkout", "-q", "--detach")
+
+	for _, backend := range []Backend{BackendGit, BackendNative} {
+		st, err := Collect(context.Background(), f.dir, Options{Backend: backend})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Branch != "v2.0" {
+			t.Errorf("expected tag v2.0 with %s backend, got %q", backend, st.Branch)
+		}
+	}
+}
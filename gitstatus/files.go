@@ -0,0 +1,33 @@
+package gitstatus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FileStatus holds a single entry from porcelain v2 output
+type FileStatus struct {
+	XY           string `json:"xy"`
+	Sub          string `json:"submodule,omitempty"`
+	ModeHead     string `json:"mode_head,omitempty"`
+	ModeIndex    string `json:"mode_index,omitempty"`
+	ModeWorktree string `json:"mode_worktree,omitempty"`
+	HashHead     string `json:"hash_head,omitempty"`
+	HashIndex    string `json:"hash_index,omitempty"`
+	Score        int    `json:"score,omitempty"`
+	Path         string `json:"path"`
+	OrigPath     string `json:"orig_path,omitempty"`
+}
+
+// IsSubmodule reports whether the entry is a submodule
+func (f *FileStatus) IsSubmodule() bool {
+	return strings.HasPrefix(f.Sub, "S")
+}
+
+// String formats the entry similar to `git status --short`
+func (f *FileStatus) String() string {
+	if f.OrigPath != "" {
+		return fmt.Sprintf("%s %s -> %s", f.XY, f.OrigPath, f.Path)
+	}
+	return fmt.Sprintf("%s %s", f.XY, f.Path)
+}
@@ -0,0 +1,133 @@
+package gitstatus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const notRepoStatus = "exit status 128"
+
+// GitExe is the git executable run by this package
+const GitExe = "git"
+
+// ErrNotAGitRepo returned when no repo found
+var ErrNotAGitRepo = errors.New("not a git repo")
+
+// GetGitStatusOutput returns a buffer of git status command output,
+// passing any extra args to git, ex: "--untracked-files=no".
+// If ctx expires before git exits, the output read so far is returned
+// along with the context error.
+func GetGitStatusOutput(ctx context.Context, cwd string, args ...string) (io.Reader, error) {
+	var buf = new(bytes.Buffer)
+	args = append([]string{"status", "--porcelain=v2", "--branch", "-z"}, args...)
+	cmd := exec.CommandContext(ctx, GitExe, args...) // #nosec
+	cmd.Stdout = buf
+	cmd.Dir = cwd
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return buf, ctx.Err()
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// GetGitNumstat returns output of diff --numstat
+func GetGitNumstat(ctx context.Context, cwd string) (string, error) {
+	cmd := exec.CommandContext(ctx, GitExe, "diff", "--numstat") // #nosec
+	cmd.Dir = cwd
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// GetGitTag returns tag name for detatched head
+func GetGitTag(ctx context.Context, cwd string) (string, error) {
+	cmd := exec.CommandContext(ctx, GitExe, "describe", "--tags", "--exact-match") // #nosec
+	cmd.Dir = cwd
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// PathToGitDir returns parsed root of git repo
+func PathToGitDir(ctx context.Context, cwd string) (string, error) {
+	cmd := exec.CommandContext(ctx, GitExe, "rev-parse", "--absolute-git-dir") // #nosec
+	cmd.Dir = cwd
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// PathToWorkTree returns the top level of the work tree containing cwd
+func PathToWorkTree(ctx context.Context, cwd string) (string, error) {
+	cmd := exec.CommandContext(ctx, GitExe, "rev-parse", "--show-toplevel") // #nosec
+	cmd.Dir = cwd
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// GetGitSubmodulePaths returns the path of each submodule in .gitmodules,
+// relative to the top level of the work tree, which cwd must be
+func GetGitSubmodulePaths(ctx context.Context, cwd string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, GitExe, "config", "--file", ".gitmodules", "--get-regexp", `^submodule\..*\.path$`) // #nosec
+	cmd.Dir = cwd
+
+	out, err := cmd.Output()
+	if err != nil {
+		// Exit status 1 means no matching keys, or no .gitmodules
+		if exiterr, ok := err.(*exec.ExitError); ok && exiterr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if fields := strings.SplitN(line, " ", 2); len(fields) == 2 {
+			paths = append(paths, fields[1])
+		}
+	}
+	return paths, nil
+}
+
+// IsInsideWorkTree returns bool to indicate if path is inside git tree
+func IsInsideWorkTree(ctx context.Context, cwd string) (bool, error) {
+	cmd := exec.CommandContext(ctx, GitExe, "rev-parse", "--is-inside-work-tree") // #nosec
+	cmd.Dir = cwd
+
+	out, err := cmd.Output()
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+				if status.ExitStatus() == 128 {
+					return false, ErrNotAGitRepo
+				}
+			}
+		}
+		if cmd.ProcessState.String() == notRepoStatus {
+			return false, ErrNotAGitRepo
+		}
+		return false, err
+	}
+	return strconv.ParseBool(strings.TrimSpace(string(out)))
+}
@@ -0,0 +1,42 @@
+package gitstatus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGroupCancelsOnError(t *testing.T) {
+	g := newGroup(context.Background())
+	errFailed := errors.New("failed")
+	cancelled := make(chan bool, 1)
+
+	g.Go(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			cancelled <- true
+		case <-time.After(5 * time.Second):
+			cancelled <- false
+		}
+		return nil
+	})
+	g.Go(func(ctx context.Context) error { return errFailed })
+
+	if err := g.Wait(); err != errFailed {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !<-cancelled {
+		t.Error("expected running functions to be cancelled after an error")
+	}
+}
+
+func TestGroupWait(t *testing.T) {
+	g := newGroup(context.Background())
+	var a, b int
+	g.Go(func(ctx context.Context) error { a = 1; return nil })
+	g.Go(func(ctx context.Context) error { b = 2; return nil })
+	if err := g.Wait(); err != nil || a != 1 || b != 2 {
+		t.Errorf("unexpected result: %d %d %v", a, b, err)
+	}
+}
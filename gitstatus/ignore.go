@@ -0,0 +1,208 @@
+package gitstatus
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignorePattern is a single line of a gitignore file
+type ignorePattern struct {
+	re       *regexp.Regexp
+	negate   bool // pattern started with "!"
+	dirOnly  bool // pattern ended with "/"
+	basename bool // pattern has no "/" and matches at any depth
+}
+
+// ignoreList holds the patterns of one ignore file, relative to base
+type ignoreList struct {
+	base     string // slash-separated dir relative to the work tree, "" for top
+	patterns []ignorePattern
+}
+
+// ignoreStack holds ignore lists in increasing order of precedence:
+// core.excludesFile, info/exclude, then each .gitignore from the top of
+// the work tree down to the current dir
+type ignoreStack []*ignoreList
+
+// parseIgnoreFile reads patterns from an ignore file; a missing
+// file yields no patterns
+func parseIgnoreFile(file, base string) *ignoreList {
+	l := &ignoreList{base: base}
+	f, err := os.Open(file) // #nosec
+	if err != nil {
+		return l
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if p, ok := parseIgnorePattern(s.Text()); ok {
+			l.patterns = append(l.patterns, p)
+		}
+	}
+	return l
+}
+
+// parseIgnorePattern parses a line of a gitignore file; see gitignore(5)
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	var p ignorePattern
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return p, false
+	}
+	if line[0] == '!' {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return p, false
+	}
+	if strings.Contains(line, "/") {
+		line = strings.TrimPrefix(line, "/")
+	} else {
+		p.basename = true
+	}
+	re, err := regexp.Compile("^" + globToRegexp(line) + "$")
+	if err != nil {
+		return p, false
+	}
+	p.re = re
+	return p, true
+}
+
+// globToRegexp converts a gitignore glob to a regular expression.
+// "*", "?" and "[...]" do not match "/"; "**" matches across dirs.
+func globToRegexp(glob string) string {
+	var out strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") {
+				atStart := i == 0 || glob[i-1] == '/'
+				rest := glob[i+2:]
+				switch {
+				case atStart && strings.HasPrefix(rest, "/"):
+					// "**/" matches zero or more leading dirs
+					out.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				case atStart && rest == "":
+					out.WriteString(".*")
+					i++
+					continue
+				}
+			}
+			out.WriteString("[^/]*")
+		case '?':
+			out.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				out.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			out.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				out.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			out.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return out.String()
+}
+
+// match reports whether rel, a slash-separated path relative to the work
+// tree, matches a pattern in the list. The last matching pattern wins.
+func (l *ignoreList) match(rel string, isDir bool) (ignored, matched bool) {
+	if l.base != "" {
+		if !strings.HasPrefix(rel, l.base+"/") {
+			return false, false
+		}
+		rel = rel[len(l.base)+1:]
+	}
+	for i := len(l.patterns) - 1; i >= 0; i-- {
+		p := l.patterns[i]
+		if p.dirOnly && !isDir {
+			continue
+		}
+		subject := rel
+		if p.basename {
+			subject = path.Base(rel)
+		}
+		if p.re.MatchString(subject) {
+			return !p.negate, true
+		}
+	}
+	return false, false
+}
+
+// isIgnored reports whether rel is ignored; more specific lists
+// take precedence over less specific ones
+func (s ignoreStack) isIgnored(rel string, isDir bool) bool {
+	for i := len(s) - 1; i >= 0; i-- {
+		if ignored, matched := s[i].match(rel, isDir); matched {
+			return ignored
+		}
+	}
+	return false
+}
+
+// push returns a new stack with the .gitignore of dir added, if it has one
+func (s ignoreStack) push(workTree, dir string) ignoreStack {
+	l := parseIgnoreFile(filepath.Join(workTree, filepath.FromSlash(dir), ".gitignore"), dir)
+	if len(l.patterns) == 0 {
+		return s
+	}
+	out := make(ignoreStack, len(s), len(s)+1)
+	copy(out, s)
+	return append(out, l)
+}
+
+// baseIgnores returns the ignore lists that apply to the whole repo
+func (r *Repo) baseIgnores() ignoreStack {
+	var s ignoreStack
+	if excludes := r.excludesFile(); excludes != "" {
+		s = append(s, parseIgnoreFile(excludes, ""))
+	}
+	return append(s, parseIgnoreFile(filepath.Join(r.CommonDir, "info", "exclude"), ""))
+}
+
+// excludesFile returns core.excludesFile from the repo or user config,
+// or its default of $XDG_CONFIG_HOME/git/ignore
+func (r *Repo) excludesFile() string {
+	return r.userFile("core.excludesfile", "ignore")
+}
+
+// userFile returns the file named by key in the repo or user config,
+// expanding "~/", or the default file of that name in $XDG_CONFIG_HOME/git
+func (r *Repo) userFile(key, name string) string {
+	home, xdg := userConfigDirs()
+	file := r.configValue(key)
+	switch {
+	case file == "" && xdg != "":
+		return filepath.Join(xdg, "git", name)
+	case strings.HasPrefix(file, "~/") && home != "":
+		return filepath.Join(home, file[2:])
+	}
+	return file
+}
@@ -0,0 +1,134 @@
+package gitstatus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// errUnsupportedIndex is returned for index features the native backend
+// does not read, ex: a split or sparse index
+var errUnsupportedIndex = errors.New("unsupported index format")
+
+// Index entry flags
+const (
+	indexAssumeValid  = 0x8000
+	indexExtended     = 0x4000
+	indexStageMask    = 0x3000
+	indexStageShift   = 12
+	indexSkipWorktree = 0x4000 // extended flags
+	indexIntentToAdd  = 0x2000 // extended flags
+)
+
+// indexEntry is a single entry of .git/index
+type indexEntry struct {
+	ctimeSec, ctimeNsec uint32
+	mtimeSec, mtimeNsec uint32
+	dev, ino            uint32
+	mode                uint32
+	uid, gid            uint32
+	size                uint32
+	hash                string
+	stage               int
+	path                string
+
+	assumeValid  bool
+	skipWorktree bool
+	intentToAdd  bool
+}
+
+// readIndex parses a version 2, 3 or 4 index file; see
+// https://git-scm.com/docs/index-format
+func readIndex(path string) ([]indexEntry, error) {
+	b, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 12+20 || !bytes.Equal(b[:4], []byte("DIRC")) {
+		return nil, fmt.Errorf("malformed index %s", path)
+	}
+	version := binary.BigEndian.Uint32(b[4:])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("%w: version %d", errUnsupportedIndex, version)
+	}
+	n := int(binary.BigEndian.Uint32(b[8:]))
+
+	entries := make([]indexEntry, 0, n)
+	body := b[:len(b)-20] // trailing checksum
+	pos := 12
+	var prev string
+	for i := 0; i < n; i++ {
+		if pos+62 > len(body) {
+			return nil, fmt.Errorf("truncated index %s", path)
+		}
+		start := pos
+		e := indexEntry{
+			ctimeSec:  binary.BigEndian.Uint32(body[pos:]),
+			ctimeNsec: binary.BigEndian.Uint32(body[pos+4:]),
+			mtimeSec:  binary.BigEndian.Uint32(body[pos+8:]),
+			mtimeNsec: binary.BigEndian.Uint32(body[pos+12:]),
+			dev:       binary.BigEndian.Uint32(body[pos+16:]),
+			ino:       binary.BigEndian.Uint32(body[pos+20:]),
+			mode:      binary.BigEndian.Uint32(body[pos+24:]),
+			uid:       binary.BigEndian.Uint32(body[pos+28:]),
+			gid:       binary.BigEndian.Uint32(body[pos+32:]),
+			size:      binary.BigEndian.Uint32(body[pos+36:]),
+			hash:      hex.EncodeToString(body[pos+40 : pos+60]),
+		}
+		flags := binary.BigEndian.Uint16(body[pos+60:])
+		e.assumeValid = flags&indexAssumeValid != 0
+		e.stage = int(flags&indexStageMask) >> indexStageShift
+		pos += 62
+
+		if flags&indexExtended != 0 {
+			if version < 3 || pos+2 > len(body) {
+				return nil, fmt.Errorf("malformed index %s", path)
+			}
+			ext := binary.BigEndian.Uint16(body[pos:])
+			e.skipWorktree = ext&indexSkipWorktree != 0
+			e.intentToAdd = ext&indexIntentToAdd != 0
+			pos += 2
+		}
+
+		if version == 4 {
+			// Path is compressed against the previous entry's path
+			r := bytes.NewReader(body[pos:])
+			strip, err := readOffsetVarint(r)
+			if err != nil || int(strip) > len(prev) {
+				return nil, fmt.Errorf("malformed index %s", path)
+			}
+			pos += int(r.Size()) - r.Len()
+			nul := bytes.IndexByte(body[pos:], 0)
+			if nul < 0 {
+				return nil, fmt.Errorf("malformed index %s", path)
+			}
+			e.path = prev[:len(prev)-int(strip)] + string(body[pos:pos+nul])
+			pos += nul + 1
+		} else {
+			nul := bytes.IndexByte(body[pos:], 0)
+			if nul < 0 {
+				return nil, fmt.Errorf("malformed index %s", path)
+			}
+			e.path = string(body[pos : pos+nul])
+			// Entries are NUL-padded to a multiple of eight bytes
+			pos = start + (pos-start+nul+8)&^7
+		}
+		prev = e.path
+		entries = append(entries, e)
+	}
+
+	// Extensions we cannot ignore mean the entries above are incomplete
+	for pos+8 <= len(body) {
+		sig := string(body[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(body[pos+4:]))
+		switch sig {
+		case "link", "sdir":
+			return nil, fmt.Errorf("%w: %q extension", errUnsupportedIndex, sig)
+		}
+		pos += 8 + size
+	}
+	return entries, nil
+}
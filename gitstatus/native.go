@@ -0,0 +1,723 @@
+package gitstatus
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/sha1" // #nosec: object names are sha1
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend selects how Collect reads work tree status
+type Backend int
+
+// Status backends
+const (
+	BackendGit    Backend = iota // parse `git status --porcelain=v2`
+	BackendNative                // read the index and work tree directly
+)
+
+// String returns the name used for the backend on the command line
+func (b Backend) String() string {
+	if b == BackendNative {
+		return "native"
+	}
+	return "git"
+}
+
+const (
+	modeFile    = 0100644
+	modeExec    = 0100755
+	modeSymlink = 0120000
+	modeGitlink = 0160000
+)
+
+var zeroHash = strings.Repeat("0", 40)
+
+// ReadStatus fills in st the way `git status --porcelain=v2 --branch`
+// would, by reading the index, HEAD tree and work tree directly.
+//
+// Stat data is compared using mtime, size and mode only, and renames are
+// detected for identical content only. Repos that need content filters
+// (ex: eol conversion or LFS), split or sparse indexes, or alternate
+// object stores return an error so the caller can fall back to git.
+// Submodules are read the same way, as are their own submodules.
+func (r *Repo) ReadStatus(ctx context.Context, st *Status) error {
+	return r.readStatus(ctx, st, true)
+}
+
+// readStatus is ReadStatus, skipping the work tree walk for untracked
+// files unless untracked is set
+func (r *Repo) readStatus(ctx context.Context, st *Status, untracked bool) error {
+	if r.WorkTree == "" {
+		return errors.New("repo has no work tree")
+	}
+	if err := r.checkNativeSupport(); err != nil {
+		return err
+	}
+	config, err := r.Config()
+	if err != nil {
+		return err
+	}
+	objects := newObjectStore(filepath.Join(r.CommonDir, "objects"))
+
+	if st.Branch, st.Commit, err = r.Head(); err != nil {
+		return err
+	}
+	if st.Branch != "(detached)" {
+		if err = r.readAheadBehind(objects, st); err != nil {
+			return err
+		}
+	}
+
+	head := make(map[string]treeEntry)
+	if st.Commit != "(initial)" {
+		c, err := objects.readCommit(st.Commit)
+		if err != nil {
+			return err
+		}
+		if err = objects.readTreeRecursive(c.tree, "", head); err != nil {
+			return err
+		}
+	}
+
+	indexPath := filepath.Join(r.GitDir, "index")
+	entries, err := readIndex(indexPath)
+	var indexTime time.Time
+	if err == nil {
+		fi, _ := os.Stat(indexPath)
+		indexTime = fi.ModTime()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	w := &worktree{
+		root:          r.WorkTree,
+		fileMode:      config["core.filemode"] != "false",
+		indexTime:     indexTime,
+		tracked:       make(map[string]bool, len(entries)),
+		dirs:          make(map[string]bool),
+		showUntracked: untracked,
+	}
+	gitlinks := false
+	for _, e := range entries {
+		gitlinks = gitlinks || e.mode == modeGitlink
+		w.tracked[e.path] = true
+		for dir := path.Dir(e.path); dir != "."; dir = path.Dir(dir) {
+			if w.dirs[dir] {
+				break
+			}
+			w.dirs[dir] = true
+		}
+	}
+	// Attributes in a dir apply to the tracked files below it, so only
+	// dirs holding tracked files need checking
+	attributes := []string{filepath.Join(r.WorkTree, ".gitattributes")}
+	for dir := range w.dirs {
+		attributes = append(attributes, filepath.Join(r.WorkTree, filepath.FromSlash(dir), ".gitattributes"))
+	}
+	if err := checkAttributes(attributes...); err != nil {
+		return err
+	}
+	if gitlinks {
+		if err := r.checkSubmoduleSupport(); err != nil {
+			return err
+		}
+	}
+
+	// Work tree changes and untracked files are independent scans
+	var changes []byte
+	var subs []string
+	var changesErr error
+	var newFiles []string
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		changes, subs, changesErr = w.checkEntries(ctx, entries)
+	}()
+	if untracked {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			newFiles = w.findUntracked(ctx, r.baseIgnores())
+		}()
+	}
+	wg.Wait()
+	if changesErr != nil {
+		return changesErr
+	}
+
+	compareIndex(st, head, entries, changes, subs)
+	for _, p := range newFiles {
+		st.Untracked++
+		st.Files = append(st.Files, FileStatus{XY: "??", Path: p})
+	}
+	return ctx.Err()
+}
+
+// checkNativeSupport returns an error for repo features ReadStatus
+// cannot reproduce faithfully. The .gitattributes files in the work
+// tree are checked by checkAttributes once the index is read.
+func (r *Repo) checkNativeSupport() error {
+	if exists(filepath.Join(r.CommonDir, "objects", "info", "alternates")) {
+		return errors.New("alternate object stores are not supported")
+	}
+	if _, err := r.Config(); err != nil {
+		return err
+	}
+	switch strings.ToLower(r.configValue("core.autocrlf")) {
+	case "", "false", "no", "off", "0":
+	default:
+		return errors.New("core.autocrlf is not supported")
+	}
+	return checkAttributes(
+		r.userFile("core.attributesfile", "attributes"),
+		filepath.Join(r.CommonDir, "info", "attributes"),
+	)
+}
+
+// checkSubmoduleSupport returns an error if submodule changes are
+// configured to be ignored, which ReadStatus does not reproduce
+func (r *Repo) checkSubmoduleSupport() error {
+	if r.configValue("diff.ignoresubmodules") != "" {
+		return errors.New("diff.ignoreSubmodules is not supported")
+	}
+	config, _ := r.Config()
+	for key := range config {
+		if strings.HasPrefix(key, "submodule.") && strings.HasSuffix(key, ".ignore") {
+			return fmt.Errorf("%s is not supported", key)
+		}
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(r.WorkTree, ".gitmodules")) // #nosec
+	if bytes.Contains(b, []byte("ignore")) {
+		return errors.New("submodule ignore setting in .gitmodules is not supported")
+	}
+	return nil
+}
+
+// checkAttributes returns an error if any of the attribute files sets
+// an attribute that changes how content is compared; missing files
+// are skipped
+func checkAttributes(files ...string) error {
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file) // #nosec
+		if err != nil {
+			continue
+		}
+		for _, attr := range []string{"filter=", "eol=", "text", "ident"} {
+			if bytes.Contains(b, []byte(attr)) {
+				return fmt.Errorf("%s attribute in %s is not supported", strings.TrimSuffix(attr, "="), file)
+			}
+		}
+	}
+	return nil
+}
+
+// readAheadBehind sets Upstream, Ahead and Behind for st.Branch
+func (r *Repo) readAheadBehind(objects *objectStore, st *Status) error {
+	remote, upstream, err := r.Upstream(st.Branch)
+	if err != nil || upstream == "" {
+		return err
+	}
+	st.Upstream = upstream
+	ref := "refs/remotes/" + upstream
+	if remote == "." {
+		ref = "refs/heads/" + upstream
+	}
+	// git omits ahead/behind if the upstream is gone
+	upHash, err := r.ResolveRef(ref)
+	if err != nil || st.Commit == "(initial)" {
+		return nil
+	}
+	st.Ahead, st.Behind, err = objects.aheadBehind(st.Commit, upHash)
+	return err
+}
+
+// compareIndex adds a file entry to st for each path that differs
+// between HEAD, the index and the work tree. changes holds the work
+// tree status code for each entry, and subs the <sub> field of each
+// submodule entry.
+func compareIndex(st *Status, head map[string]treeEntry, entries []indexEntry, changes []byte, subs []string) {
+	var files []FileStatus
+	unmerged := make(map[string]int)
+	inIndex := make(map[string]bool, len(entries))
+	var added []int // indexes into files of entries not in HEAD
+
+	for i, e := range entries {
+		inIndex[e.path] = true
+		if e.stage > 0 {
+			unmerged[e.path] |= 1 << uint(e.stage-1)
+			continue
+		}
+		f := FileStatus{
+			Sub:          "N...",
+			ModeHead:     "000000",
+			ModeIndex:    fmt.Sprintf("%06o", e.mode),
+			ModeWorktree: fmt.Sprintf("%06o", e.mode),
+			HashHead:     zeroHash,
+			HashIndex:    e.hash,
+			Path:         e.path,
+		}
+		if e.mode == modeGitlink {
+			f.Sub = subs[i]
+		}
+		x := byte('.')
+		if h, ok := head[e.path]; ok {
+			f.ModeHead, f.HashHead = fmt.Sprintf("%06o", h.mode), h.hash
+			switch {
+			case h.mode&0170000 != e.mode&0170000:
+				x = 'T'
+			case h.hash != e.hash || h.mode != e.mode:
+				x = 'M'
+			}
+		} else if e.intentToAdd {
+			f.HashIndex = zeroHash
+		} else {
+			x = 'A'
+			added = append(added, len(files))
+		}
+		if changes[i] == 'D' {
+			f.ModeWorktree = "000000"
+		}
+		if x == '.' && changes[i] == '.' {
+			continue
+		}
+		f.XY = string([]byte{x, changes[i]})
+		files = append(files, f)
+	}
+
+	// Paths in HEAD missing from the index are staged deletions,
+	// or the source of a rename if the content was added elsewhere
+	var deleted []string
+	for p := range head {
+		if !inIndex[p] {
+			deleted = append(deleted, p)
+		}
+	}
+	sort.Strings(deleted)
+	for _, p := range deleted {
+		h := head[p]
+		renamed := false
+		for j, k := range added {
+			if f := &files[k]; f.HashIndex == h.hash {
+				f.XY = "R" + f.XY[1:]
+				f.OrigPath, f.Score = p, 100
+				f.ModeHead, f.HashHead = fmt.Sprintf("%06o", h.mode), h.hash
+				added = append(added[:j], added[j+1:]...)
+				renamed = true
+				break
+			}
+		}
+		if renamed {
+			continue
+		}
+		files = append(files, FileStatus{
+			XY:           "D.",
+			Sub:          "N...",
+			ModeHead:     fmt.Sprintf("%06o", h.mode),
+			ModeIndex:    "000000",
+			ModeWorktree: "000000",
+			HashHead:     h.hash,
+			HashIndex:    zeroHash,
+			Path:         p,
+		})
+	}
+
+	for p, stages := range unmerged {
+		files = append(files, FileStatus{XY: conflictXY(stages), Sub: "N...", Path: p})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	for _, f := range files {
+		if f.XY[0] == 'U' || f.XY[1] == 'U' || f.XY == "DD" || f.XY == "AA" {
+			st.Unmerged++
+			st.Conflicts.parseConflict(f.XY)
+			st.Files = append(st.Files, f)
+			continue
+		}
+		st.addFile(f)
+	}
+}
+
+// conflictXY returns the unmerged status code for the set of stages
+// present (bit 0 base, bit 1 ours, bit 2 theirs)
+func conflictXY(stages int) string {
+	switch stages {
+	case 1:
+		return "DD"
+	case 2:
+		return "AU"
+	case 3:
+		return "UD"
+	case 4:
+		return "UA"
+	case 5:
+		return "DU"
+	case 6:
+		return "AA"
+	}
+	return "UU"
+}
+
+// worktree compares index entries against files on disk
+type worktree struct {
+	root      string
+	fileMode  bool // core.filemode; compare the executable bit
+	indexTime time.Time
+	tracked   map[string]bool // slash-separated paths in the index
+	dirs      map[string]bool // dirs containing tracked paths
+
+	showUntracked bool // report untracked files in submodules
+
+	mu        sync.Mutex
+	untracked []string
+}
+
+// checkEntries returns the work tree status code for each index entry,
+// and the <sub> field for each submodule, checking entries in parallel
+func (w *worktree) checkEntries(ctx context.Context, entries []indexEntry) ([]byte, []string, error) {
+	changes := bytes.Repeat([]byte{'.'}, len(entries))
+	subs := make([]string, len(entries))
+	workers := runtime.NumCPU()
+	chunk := (len(entries) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for start := 0; start < len(entries); start += chunk {
+		end := start + chunk
+		if end > len(entries) {
+			end = len(entries)
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end && ctx.Err() == nil; i++ {
+				e := &entries[i]
+				if e.stage > 0 {
+					continue
+				}
+				if e.mode != modeGitlink {
+					changes[i] = w.checkEntry(e)
+					continue
+				}
+				var err error
+				if changes[i], subs[i], err = w.checkGitlink(ctx, e); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	close(errs)
+	return changes, subs, <-errs
+}
+
+// checkEntry returns the status code of a single entry in the work tree
+func (w *worktree) checkEntry(e *indexEntry) byte {
+	if e.skipWorktree || e.assumeValid {
+		return '.'
+	}
+	if e.intentToAdd {
+		return 'A'
+	}
+	full := filepath.Join(w.root, filepath.FromSlash(e.path))
+	fi, err := os.Lstat(full)
+	if err != nil {
+		return 'D'
+	}
+	if fi.IsDir() {
+		return 'D'
+	}
+
+	mode := uint32(modeFile)
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		mode = modeSymlink
+	case fi.Mode()&0100 != 0:
+		mode = modeExec
+	}
+	if !w.fileMode && mode != modeSymlink && e.mode != modeSymlink {
+		mode = e.mode
+	}
+	if mode&0170000 != e.mode&0170000 {
+		return 'T'
+	}
+	if mode != e.mode {
+		return 'M'
+	}
+
+	// Matching stat data means unchanged, unless the file was written
+	// in the same instant as the index ("racy git")
+	mtime := fi.ModTime()
+	if mtime.Unix() == int64(e.mtimeSec) && mtime.Nanosecond() == int(e.mtimeNsec) &&
+		uint32(fi.Size()) == e.size && mtime.Before(w.indexTime) {
+		return '.'
+	}
+	if uint32(fi.Size()) != e.size {
+		return 'M'
+	}
+	hash, err := hashFile(full, fi)
+	if err != nil || hash != e.hash {
+		return 'M'
+	}
+	return '.'
+}
+
+// checkGitlink returns the status code and <sub> field of a submodule:
+// 'M' if its HEAD is not the commit in the index, or if its own status
+// shows changes. A submodule that is not checked out is unchanged.
+func (w *worktree) checkGitlink(ctx context.Context, e *indexEntry) (byte, string, error) {
+	if e.skipWorktree || e.assumeValid {
+		return '.', "S...", nil
+	}
+	full := filepath.Join(w.root, filepath.FromSlash(e.path))
+	if _, err := os.Lstat(full); err != nil {
+		return 'D', "S...", nil
+	}
+	if !exists(filepath.Join(full, ".git")) {
+		return '.', "S...", nil
+	}
+	sub, err := openSubmodule(full)
+	if err != nil {
+		return 0, "", err
+	}
+	st := new(Status)
+	if err := sub.readStatus(ctx, st, w.showUntracked); err != nil {
+		return 0, "", fmt.Errorf("submodule `%s': %s", e.path, err)
+	}
+
+	flags := []byte("S...")
+	if st.Commit != e.hash {
+		flags[1] = 'C'
+	}
+	if len(st.Files) > st.Untracked {
+		flags[2] = 'M'
+	}
+	if st.Untracked > 0 {
+		flags[3] = 'U'
+	}
+	if string(flags) == "S..." {
+		return '.', "S...", nil
+	}
+	return 'M', string(flags), nil
+}
+
+// hashFile returns the blob object name of a file or symlink
+func hashFile(file string, fi os.FileInfo) (string, error) {
+	h := sha1.New() // #nosec
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "blob %d\x00%s", len(target), target)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	f, err := os.Open(file) // #nosec
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fmt.Fprintf(h, "blob %d\x00", fi.Size())
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// findUntracked walks the work tree in parallel and returns untracked
+// paths, sorted. Like `git status --untracked-files=normal`, a dir with
+// no tracked files is reported once with a trailing slash.
+func (w *worktree) findUntracked(ctx context.Context, ignores ignoreStack) []string {
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+
+	// ignored is set under an ignored dir: its tracked files keep it in
+	// the walk, but nothing else in it is untracked
+	var walk func(dir string, ignores ignoreStack, ignored bool)
+	walk = func(dir string, ignores ignoreStack, ignored bool) {
+		if ctx.Err() != nil {
+			return
+		}
+		ignores = ignores.push(w.root, dir)
+		infos, err := ioutil.ReadDir(filepath.Join(w.root, filepath.FromSlash(dir)))
+		if err != nil {
+			return
+		}
+		for _, fi := range infos {
+			rel := path.Join(dir, fi.Name())
+			if fi.Name() == ".git" || w.tracked[rel] {
+				continue
+			}
+			if fi.IsDir() && w.dirs[rel] {
+				ignored := ignored || ignores.isIgnored(rel, true)
+				select {
+				case sem <- struct{}{}:
+					wg.Add(1)
+					go func(rel string) {
+						defer func() { <-sem; wg.Done() }()
+						walk(rel, ignores, ignored)
+					}(rel)
+				default:
+					walk(rel, ignores, ignored)
+				}
+				continue
+			}
+			if ignored || ignores.isIgnored(rel, fi.IsDir()) {
+				continue
+			}
+			if fi.IsDir() {
+				if !w.hasUntracked(rel, ignores) {
+					continue
+				}
+				rel += "/"
+			}
+			w.mu.Lock()
+			w.untracked = append(w.untracked, rel)
+			w.mu.Unlock()
+		}
+	}
+	walk("", ignores, false)
+	wg.Wait()
+
+	sort.Strings(w.untracked)
+	return w.untracked
+}
+
+// hasUntracked reports whether dir, which holds no tracked files,
+// contains anything that is not ignored
+func (w *worktree) hasUntracked(dir string, ignores ignoreStack) bool {
+	full := filepath.Join(w.root, filepath.FromSlash(dir))
+	// A nested repo is shown even if it is empty
+	if isGitDir(filepath.Join(full, ".git")) {
+		return true
+	}
+	ignores = ignores.push(w.root, dir)
+	infos, err := ioutil.ReadDir(full)
+	if err != nil {
+		return false
+	}
+	for _, fi := range infos {
+		rel := path.Join(dir, fi.Name())
+		if fi.Name() == ".git" || ignores.isIgnored(rel, fi.IsDir()) {
+			continue
+		}
+		if !fi.IsDir() || w.hasUntracked(rel, ignores) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGitDir reports whether dotGit is a usable git dir, or a file
+// pointing to one, the same checks git makes before treating a
+// nested dir as a repo
+func isGitDir(dotGit string) bool {
+	if gitDir, err := readGitFile(dotGit); err == nil {
+		dotGit = gitDir
+	}
+	if !isDir(filepath.Join(dotGit, "objects")) || !isDir(filepath.Join(dotGit, "refs")) {
+		return false
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dotGit, "HEAD")) // #nosec
+	if err != nil {
+		return false
+	}
+	head := strings.TrimSpace(string(b))
+	return strings.HasPrefix(head, "ref: refs/") || len(head) == 40
+}
+
+// aheadBehind counts commits reachable from local but not upstream and
+// vice versa. Commits are walked newest first from both tips until
+// every queued commit is reachable from both, as git does.
+func (s *objectStore) aheadBehind(local, upstream string) (ahead, behind int, err error) {
+	const (
+		fromLocal    = 1
+		fromUpstream = 2
+		fromBoth     = fromLocal | fromUpstream
+	)
+	flags := make(map[string]int)
+	q := &commitQueue{}
+
+	push := func(hash string, f int) error {
+		if flags[hash]&f == f {
+			return nil
+		}
+		flags[hash] |= f
+		c, err := s.readCommit(hash)
+		if err != nil {
+			return err
+		}
+		heap.Push(q, queuedCommit{hash: hash, commit: c})
+		return nil
+	}
+	if err := push(local, fromLocal); err != nil {
+		return 0, 0, err
+	}
+	if err := push(upstream, fromUpstream); err != nil {
+		return 0, 0, err
+	}
+
+	for q.Len() > 0 && !q.allFlagged(flags, fromBoth) {
+		next := heap.Pop(q).(queuedCommit)
+		for _, p := range next.commit.parents {
+			if err := push(p, flags[next.hash]); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	for _, f := range flags {
+		switch f {
+		case fromLocal:
+			ahead++
+		case fromUpstream:
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+type queuedCommit struct {
+	hash   string
+	commit *commitInfo
+}
+
+// commitQueue is a heap of commits ordered newest first
+type commitQueue []queuedCommit
+
+func (q commitQueue) Len() int            { return len(q) }
+func (q commitQueue) Less(i, j int) bool  { return q[i].commit.time > q[j].commit.time }
+func (q commitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(queuedCommit)) }
+
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// allFlagged reports whether every queued commit has all bits of f set
+func (q commitQueue) allFlagged(flags map[string]int, f int) bool {
+	for _, c := range q {
+		if flags[c.hash]&f != f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,370 @@
+package gitstatus
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// gitFixture is a scratch repo built by running git
+type gitFixture struct {
+	t       *testing.T
+	dir     string
+	env     []string
+	commits int
+}
+
+// newGitFixture creates an empty repo on branch master. HOME and
+// XDG_CONFIG_HOME point at an empty dir so user config is not read.
+func newGitFixture(t *testing.T) (*gitFixture, func()) {
+	if _, err := exec.LookPath(GitExe); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "gitprompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := filepath.Join(dir, "home")
+	f := &gitFixture{t: t, dir: filepath.Join(dir, "repo")}
+	f.env = append(os.Environ(),
+		"HOME="+home,
+		"XDG_CONFIG_HOME="+home,
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=gitprompt",
+		"GIT_AUTHOR_EMAIL=gitprompt@example.com",
+		"GIT_COMMITTER_NAME=gitprompt",
+		"GIT_COMMITTER_EMAIL=gitprompt@example.com",
+	)
+	writeFiles(t, home, map[string]string{".gitconfig": ""})
+
+	oldHome, oldXDG := os.Getenv("HOME"), os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("HOME", home)
+	os.Setenv("XDG_CONFIG_HOME", home)
+
+	f.git("init", "-q", f.dir)
+	f.git("symbolic-ref", "HEAD", "refs/heads/master")
+	return f, func() {
+		os.Setenv("HOME", oldHome)
+		os.Setenv("XDG_CONFIG_HOME", oldXDG)
+		os.RemoveAll(dir)
+	}
+}
+
+// git runs a git command in the fixture repo, failing the test on error.
+// A failed merge is expected to leave conflicts, so is not an error.
+func (f *gitFixture) git(args ...string) string {
+	f.t.Helper()
+	cmd := exec.Command(GitExe, args...)
+	cmd.Dir = filepath.Dir(f.dir)
+	if _, err := os.Stat(f.dir); err == nil {
+		cmd.Dir = f.dir
+	}
+	cmd.Env = f.env
+	out, err := cmd.CombinedOutput()
+	if err != nil && args[0] != "merge" {
+		f.t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func (f *gitFixture) write(files map[string]string) {
+	writeFiles(f.t, f.dir, files)
+}
+
+// commit stages everything and commits with a fixed, increasing date
+func (f *gitFixture) commit(msg string) {
+	f.t.Helper()
+	f.git("add", "-A")
+	f.commits++
+	date := fmt.Sprintf("2020-01-01T00:%02d:00", f.commits)
+	f.env = append(f.env, "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	f.git("commit", "-q", "--allow-empty", "-m", msg)
+}
+
+// compareBackends checks that ReadStatus agrees with `git status`.
+// The native backend is checked both before and after git refreshes
+// the stat data in the index.
+func compareBackends(t *testing.T, dir string) {
+	t.Helper()
+	for _, when := range []string{"before", "after"} {
+		repo, err := OpenRepo(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		native := new(Status)
+		if err := repo.ReadStatus(context.Background(), native); err != nil {
+			t.Fatalf("native status %s git refresh: %s", when, err)
+		}
+		gitOut, err := GetGitStatusOutput(context.Background(), dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := new(Status)
+		if err := expected.Parse(gitOut); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, st := range []*Status{native, expected} {
+			sort.Slice(st.Files, func(i, j int) bool { return st.Files[i].Path < st.Files[j].Path })
+		}
+		if got, want := summarize(native), summarize(expected); !reflect.DeepEqual(got, want) {
+			t.Errorf("native status %s git refresh differs\ngot:  %v\nwant: %v", when, got, want)
+		}
+	}
+}
+
+// summarize returns the fields both backends are expected to agree on
+func summarize(st *Status) []interface{} {
+	var files []string
+	for _, f := range st.Files {
+		files = append(files, f.String())
+	}
+	return []interface{}{
+		st.Branch, st.Commit, st.Upstream, st.Ahead, st.Behind,
+		st.Untracked, st.Unmerged, st.Staged, st.Unstaged, st.Conflicts, st.Submodules, files,
+	}
+}
+
+func TestNativeStatusWorktree(t *testing.T) {
+	f, cleanup := newGitFixture(t)
+	defer cleanup()
+
+	f.write(map[string]string{
+		"a.txt":          "hello\n",
+		"dir/b.txt":      "b\n",
+		"dir/sub/c.txt":  "c\n",
+		"del.txt":        "delete me\n",
+		"ren.txt":        "rename me\n",
+		"staged.txt":     "staged\n",
+		"keep.txt":       "unchanged\n",
+		".gitignore":     "*.log\n!keep.log\nbuild/\n/top-only\n**/deep/*.tmp\n",
+		"dir/.gitignore": "ignored.*\n!ignored.keep\n",
+	})
+	if err := os.Symlink("a.txt", filepath.Join(f.dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	// A tracked file keeps the ignored build/ in the walk
+	f.write(map[string]string{"build/keep": "keep\n"})
+	f.git("add", "-f", "build/keep")
+	f.commit("initial")
+	compareBackends(t, f.dir)
+
+	// Same size, different content needs hashing to detect
+	f.write(map[string]string{"a.txt": "jello\n"})
+	if err := os.Chmod(filepath.Join(f.dir, "dir", "b.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(f.dir, "del.txt"))
+	os.Remove(filepath.Join(f.dir, "link"))
+	if err := os.Symlink("keep.txt", filepath.Join(f.dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	f.git("mv", "ren.txt", "renamed.txt")
+	f.write(map[string]string{"staged.txt": "staged and changed\n", "new.txt": "new\n"})
+	f.git("add", "staged.txt", "new.txt")
+	f.git("rm", "-q", "--cached", "dir/sub/c.txt")
+	f.write(map[string]string{".git/info/exclude": "excluded.txt\n"})
+
+	f.write(map[string]string{
+		"u.txt":              "",
+		"newdir/x/y.txt":     "",
+		"x.log":              "",
+		"keep.log":           "",
+		"build/out":          "",
+		"build/sub/new.o":    "",
+		"top-only":           "",
+		"dir/top-only":       "",
+		"dir/ignored.txt":    "",
+		"dir/ignored.keep":   "",
+		"a/deep/z.tmp":       "",
+		"a/deep/z.dat":       "",
+		"onlyignored/a.log":  "",
+		"excluded.txt":       "",
+		"fake/.git/HEAD":     "",
+		"dir/sub/more/d.log": "",
+	})
+	if err := os.MkdirAll(filepath.Join(f.dir, "emptydir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f.git("init", "-q", "nested")
+	compareBackends(t, f.dir)
+}
+
+func TestNativeStatusPackedHistory(t *testing.T) {
+	f, cleanup := newGitFixture(t)
+	defer cleanup()
+
+	// Large, similar files give git something to deltify
+	body := strings.Repeat("line of text for delta compression\n", 200)
+	f.write(map[string]string{"big.txt": body, "dir/other.txt": "other\n"})
+	f.commit("base")
+	f.git("branch", "upstream")
+	f.git("branch", "--set-upstream-to=upstream")
+
+	for i, s := range []string{"one", "two"} {
+		f.write(map[string]string{"big.txt": body + strings.Repeat(s+"\n", i+1)})
+		f.commit("local " + s)
+	}
+	f.git("checkout", "-q", "upstream")
+	f.write(map[string]string{"dir/other.txt": "upstream\n"})
+	f.commit("upstream change")
+	f.git("checkout", "-q", "master")
+	f.git("gc", "-q")
+
+	repo, err := OpenRepo(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loose, _ := filepath.Glob(filepath.Join(repo.CommonDir, "objects", "??", "*")); len(loose) > 0 {
+		t.Fatalf("expected all objects to be packed, found %v", loose)
+	}
+	f.write(map[string]string{"big.txt": body})
+	compareBackends(t, f.dir)
+
+	// Version 4 index with prefix-compressed paths, and an intent-to-add
+	// entry that needs the version 3 extended flags
+	f.write(map[string]string{"dir/nested/intent.txt": "intent\n"})
+	f.git("add", "-N", "dir/nested/intent.txt")
+	f.git("update-index", "--index-version", "4")
+	compareBackends(t, f.dir)
+}
+
+func TestNativeStatusConflicts(t *testing.T) {
+	f, cleanup := newGitFixture(t)
+	defer cleanup()
+
+	f.write(map[string]string{
+		"both.txt":     "base\n",
+		"modified.txt": "base\n",
+		"deleted.txt":  "base\n",
+	})
+	f.commit("base")
+	f.git("checkout", "-q", "-b", "theirs")
+	f.write(map[string]string{"both.txt": "theirs\n", "modified.txt": "theirs\n", "added.txt": "theirs\n"})
+	os.Remove(filepath.Join(f.dir, "deleted.txt"))
+	f.commit("theirs")
+	f.git("checkout", "-q", "master")
+	f.write(map[string]string{"both.txt": "ours\n", "deleted.txt": "ours\n", "added.txt": "ours\n"})
+	os.Remove(filepath.Join(f.dir, "modified.txt"))
+	f.commit("ours")
+	f.git("merge", "-q", "theirs")
+
+	compareBackends(t, f.dir)
+}
+
+func TestNativeStatusSubmodule(t *testing.T) {
+	f, cleanup := newGitFixture(t)
+	defer cleanup()
+
+	f.write(map[string]string{
+		"a.txt":       "a\n",
+		"lib/b.txt":   "b\n",
+		".gitmodules": "[submodule \"lib\"]\n\tpath = lib\n\turl = ./lib\n",
+	})
+	f.git("-C", "lib", "init", "-q")
+	f.git("-C", "lib", "add", "-A")
+	f.git("-C", "lib", "commit", "-q", "-m", "lib")
+	f.commit("initial")
+	compareBackends(t, f.dir)
+
+	f.write(map[string]string{"lib/new.txt": ""})
+	compareBackends(t, f.dir)
+	f.write(map[string]string{"lib/b.txt": "changed\n"})
+	compareBackends(t, f.dir)
+	f.git("-C", "lib", "commit", "-q", "-a", "-m", "change")
+	compareBackends(t, f.dir)
+	f.git("add", "lib")
+	compareBackends(t, f.dir)
+
+	// Submodule changes git is told to ignore fall back to git
+	f.git("config", "submodule.lib.ignore", "all")
+	repo, err := OpenRepo(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ReadStatus(context.Background(), new(Status)); err == nil {
+		t.Error("expected an error with submodule.lib.ignore set")
+	}
+}
+
+func TestNativeStatusInitial(t *testing.T) {
+	f, cleanup := newGitFixture(t)
+	defer cleanup()
+
+	compareBackends(t, f.dir)
+	f.write(map[string]string{"staged.txt": "", "dir/untracked.txt": ""})
+	f.git("add", "staged.txt")
+	compareBackends(t, f.dir)
+}
+
+func TestNativeStatusUnsupported(t *testing.T) {
+	f, cleanup := newGitFixture(t)
+	defer cleanup()
+
+	f.write(map[string]string{"a.txt": "a\n", "sub/b.txt": "b\n"})
+	f.commit("initial")
+	readStatus := func() error {
+		repo, err := OpenRepo(f.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo.readStatus(context.Background(), new(Status), false)
+	}
+	if err := readStatus(); err != nil {
+		t.Fatal(err)
+	}
+
+	home := os.Getenv("HOME")
+	for _, tt := range []struct {
+		file, content string
+	}{
+		{filepath.Join(home, ".gitconfig"), "[core]\n\tautocrlf = true\n"},
+		{filepath.Join(home, "git", "config"), "[core]\n\tautocrlf = input\n"},
+		{filepath.Join(home, "git", "attributes"), "*.txt eol=crlf\n"},
+		{filepath.Join(f.dir, "sub", ".gitattributes"), "*.bin filter=lfs diff=lfs\n"},
+	} {
+		writeFiles(t, filepath.Dir(tt.file), map[string]string{filepath.Base(tt.file): tt.content})
+		if err := readStatus(); err == nil {
+			t.Errorf("expected an error with %q in %s", tt.content, tt.file)
+		}
+		os.Remove(tt.file)
+	}
+}
+
+func TestParseIgnorePattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, path  string
+		isDir, ignored bool
+	}{
+		{"*.log", "a/b/c.log", false, true},
+		{"/top", "a/top", false, false},
+		{"/top", "top", false, true},
+		{"build/", "build", false, false},
+		{"build/", "a/build", true, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"**/foo", "x/foo", false, true},
+		{"a/**", "a/x/y", false, true},
+		{"doc/*.txt", "doc/x/y.txt", false, false},
+		{"[!a]bc", "xbc", false, true},
+		{"[!a]bc", "abc", false, false},
+		{`\#hash`, "#hash", false, true},
+		{"?.c", "ab.c", false, false},
+	} {
+		p, ok := parseIgnorePattern(tc.pattern)
+		if !ok {
+			t.Fatalf("pattern %q not parsed", tc.pattern)
+		}
+		l := &ignoreList{patterns: []ignorePattern{p}}
+		if ignored, _ := l.match(tc.path, tc.isDir); ignored != tc.ignored {
+			t.Errorf("%q matching %q: got %v, want %v", tc.pattern, tc.path, ignored, tc.ignored)
+		}
+	}
+}
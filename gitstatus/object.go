@@ -0,0 +1,458 @@
+package gitstatus
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errObjectNotFound is returned when an object is neither loose nor packed
+var errObjectNotFound = errors.New("object not found")
+
+// Pack object types
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+var objTypeNames = map[int]string{
+	objCommit: "commit",
+	objTree:   "tree",
+	objBlob:   "blob",
+	objTag:    "tag",
+}
+
+// objectStore reads loose and packed objects from an objects dir
+type objectStore struct {
+	dir string
+
+	once  sync.Once
+	packs []*packFile
+	err   error
+}
+
+// packFile is a single pack and its v2 index, loaded into memory
+type packFile struct {
+	path      string
+	fanout    [256]uint32
+	hashes    []byte // 20 bytes per object, sorted
+	offsets   []byte // 4 bytes per object
+	offsets64 []byte // 8 bytes per large offset
+
+	mu    sync.Mutex
+	f     *os.File
+	cache map[int64]packedObject // resolved delta bases by offset
+}
+
+type packedObject struct {
+	typ  int
+	data []byte
+}
+
+func newObjectStore(dir string) *objectStore {
+	return &objectStore{dir: dir}
+}
+
+// readObject returns the type name and content of the object with hash
+func (s *objectStore) readObject(hash string) (string, []byte, error) {
+	typ, data, err := s.readLoose(hash)
+	if err == nil || !os.IsNotExist(err) {
+		return typ, data, err
+	}
+
+	s.once.Do(s.loadPacks)
+	if s.err != nil {
+		return "", nil, s.err
+	}
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid object name %q", hash)
+	}
+	for _, p := range s.packs {
+		if offset, ok := p.find(raw); ok {
+			obj, err := p.readAt(s, offset)
+			if err != nil {
+				return "", nil, err
+			}
+			return objTypeNames[obj.typ], obj.data, nil
+		}
+	}
+	return "", nil, errObjectNotFound
+}
+
+// readLoose reads a zlib-compressed loose object
+func (s *objectStore) readLoose(hash string) (string, []byte, error) {
+	if len(hash) != 40 {
+		return "", nil, fmt.Errorf("invalid object name %q", hash)
+	}
+	f, err := os.Open(filepath.Join(s.dir, hash[:2], hash[2:]))
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	z, err := zlib.NewReader(f)
+	if err != nil {
+		return "", nil, err
+	}
+	defer z.Close()
+
+	b, err := ioutil.ReadAll(z)
+	if err != nil {
+		return "", nil, err
+	}
+	// Header is "<type> <size>\x00"
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", nil, fmt.Errorf("malformed object %s", hash)
+	}
+	header := strings.SplitN(string(b[:i]), " ", 2)
+	return header[0], b[i+1:], nil
+}
+
+// loadPacks reads the index of every pack in objects/pack
+func (s *objectStore) loadPacks() {
+	idxFiles, err := filepath.Glob(filepath.Join(s.dir, "pack", "*.idx"))
+	if err != nil {
+		s.err = err
+		return
+	}
+	sort.Strings(idxFiles)
+	for _, idx := range idxFiles {
+		p, err := openPack(idx)
+		if err != nil {
+			s.err = err
+			return
+		}
+		s.packs = append(s.packs, p)
+	}
+}
+
+// openPack loads a version 2 pack index
+func openPack(idxPath string) (*packFile, error) {
+	b, err := ioutil.ReadFile(idxPath) // #nosec
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8+256*4 || !bytes.Equal(b[:4], []byte("\xfftOc")) || binary.BigEndian.Uint32(b[4:]) != 2 {
+		return nil, fmt.Errorf("unsupported pack index %s", idxPath)
+	}
+	p := &packFile{
+		path:  strings.TrimSuffix(idxPath, ".idx") + ".pack",
+		cache: make(map[int64]packedObject),
+	}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(b[8+i*4:])
+	}
+	n := int(p.fanout[255])
+	pos := 8 + 256*4
+	if len(b) < pos+n*28 {
+		return nil, fmt.Errorf("truncated pack index %s", idxPath)
+	}
+	p.hashes = b[pos : pos+n*20]
+	pos += n * 20
+	pos += n * 4 // CRC32s
+	p.offsets = b[pos : pos+n*4]
+	pos += n * 4
+	p.offsets64 = b[pos:]
+	return p, nil
+}
+
+// find returns the pack offset of the object with raw hash
+func (p *packFile) find(raw []byte) (int64, bool) {
+	var lo uint32
+	if raw[0] > 0 {
+		lo = p.fanout[raw[0]-1]
+	}
+	hi := p.fanout[raw[0]]
+	i := lo + uint32(sort.Search(int(hi-lo), func(i int) bool {
+		j := int(lo) + i
+		return bytes.Compare(p.hashes[j*20:j*20+20], raw) >= 0
+	}))
+	if i >= hi || !bytes.Equal(p.hashes[i*20:i*20+20], raw) {
+		return 0, false
+	}
+	off := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if off&0x80000000 == 0 {
+		return int64(off), true
+	}
+	j := int(off & 0x7fffffff)
+	return int64(binary.BigEndian.Uint64(p.offsets64[j*8:])), true
+}
+
+// readAt reads and fully resolves the object at offset
+func (p *packFile) readAt(s *objectStore, offset int64) (packedObject, error) {
+	p.mu.Lock()
+	if obj, ok := p.cache[offset]; ok {
+		p.mu.Unlock()
+		return obj, nil
+	}
+	if p.f == nil {
+		f, err := os.Open(p.path)
+		if err != nil {
+			p.mu.Unlock()
+			return packedObject{}, err
+		}
+		p.f = f
+	}
+	r := bufio.NewReader(io.NewSectionReader(p.f, offset, 1<<62))
+
+	// Type and inflated size are a variable-length header
+	c, err := r.ReadByte()
+	if err != nil {
+		p.mu.Unlock()
+		return packedObject{}, err
+	}
+	typ := int(c>>4) & 7
+	for c&0x80 != 0 {
+		if c, err = r.ReadByte(); err != nil {
+			p.mu.Unlock()
+			return packedObject{}, err
+		}
+	}
+
+	var baseOffset int64
+	var baseHash string
+	switch typ {
+	case objOfsDelta:
+		rel, err := readOffsetVarint(r)
+		if err != nil {
+			p.mu.Unlock()
+			return packedObject{}, err
+		}
+		baseOffset = offset - rel
+	case objRefDelta:
+		raw := make([]byte, 20)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			p.mu.Unlock()
+			return packedObject{}, err
+		}
+		baseHash = hex.EncodeToString(raw)
+	}
+
+	data, err := inflate(r)
+	p.mu.Unlock()
+	if err != nil {
+		return packedObject{}, err
+	}
+
+	var obj packedObject
+	switch typ {
+	case objOfsDelta:
+		base, err := p.readAt(s, baseOffset)
+		if err != nil {
+			return packedObject{}, err
+		}
+		obj.typ = base.typ
+		obj.data, err = applyDelta(base.data, data)
+		if err != nil {
+			return packedObject{}, err
+		}
+	case objRefDelta:
+		typName, baseData, err := s.readObject(baseHash)
+		if err != nil {
+			return packedObject{}, err
+		}
+		for t, name := range objTypeNames {
+			if name == typName {
+				obj.typ = t
+			}
+		}
+		obj.data, err = applyDelta(baseData, data)
+		if err != nil {
+			return packedObject{}, err
+		}
+	default:
+		obj = packedObject{typ: typ, data: data}
+	}
+
+	// Trees and commits are read repeatedly as delta bases
+	if obj.typ != objBlob {
+		p.mu.Lock()
+		if len(p.cache) > 4096 {
+			p.cache = make(map[int64]packedObject)
+		}
+		p.cache[offset] = obj
+		p.mu.Unlock()
+	}
+	return obj, nil
+}
+
+func inflate(r io.Reader) ([]byte, error) {
+	z, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	return ioutil.ReadAll(z)
+}
+
+// readOffsetVarint reads the base offset encoding used by OFS_DELTA
+// and index v4 path prefixes
+func readOffsetVarint(r io.ByteReader) (int64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	v := int64(c & 0x7f)
+	for c&0x80 != 0 {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		v = ((v + 1) << 7) | int64(c&0x7f)
+	}
+	return v, nil
+}
+
+// applyDelta rebuilds an object from its base and a pack delta
+func applyDelta(base, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	srcSize, err := binary.ReadUvarint(r)
+	if err != nil || srcSize != uint64(len(base)) {
+		return nil, errors.New("delta base size mismatch")
+	}
+	dstSize, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, dstSize)
+	for {
+		op, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if op&0x80 == 0 {
+			// Insert the next op bytes
+			if op == 0 {
+				return nil, errors.New("invalid delta opcode")
+			}
+			buf := make([]byte, op)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, err
+			}
+			out = append(out, buf...)
+			continue
+		}
+		// Copy from base; bits 0-3 select offset bytes, 4-6 size bytes
+		var off, size uint32
+		for i := uint(0); i < 7; i++ {
+			if op&(1<<i) == 0 {
+				continue
+			}
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if i < 4 {
+				off |= uint32(b) << (8 * i)
+			} else {
+				size |= uint32(b) << (8 * (i - 4))
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if uint64(off)+uint64(size) > uint64(len(base)) {
+			return nil, errors.New("delta copy out of range")
+		}
+		out = append(out, base[off:off+size]...)
+	}
+	if uint64(len(out)) != dstSize {
+		return nil, errors.New("delta result size mismatch")
+	}
+	return out, nil
+}
+
+// commitInfo holds the parts of a commit needed for walking history
+type commitInfo struct {
+	tree    string
+	parents []string
+	time    int64
+}
+
+// readCommit parses a commit object
+func (s *objectStore) readCommit(hash string) (*commitInfo, error) {
+	typ, data, err := s.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if typ != "commit" {
+		return nil, fmt.Errorf("%s is a %s, not a commit", hash, typ)
+	}
+	var c commitInfo
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			break // end of headers
+		}
+		switch fields := strings.SplitN(line, " ", 2); fields[0] {
+		case "tree":
+			c.tree = fields[1]
+		case "parent":
+			c.parents = append(c.parents, fields[1])
+		case "committer":
+			// "name <email> <unix time> <tz>"
+			parts := strings.Fields(fields[1])
+			if len(parts) >= 2 {
+				c.time, _ = strconv.ParseInt(parts[len(parts)-2], 10, 64)
+			}
+		}
+	}
+	return &c, nil
+}
+
+// treeEntry is a blob, symlink or gitlink reachable from a tree
+type treeEntry struct {
+	mode uint32
+	hash string
+}
+
+// readTreeRecursive flattens a tree into a map of slash-separated paths
+func (s *objectStore) readTreeRecursive(hash, prefix string, out map[string]treeEntry) error {
+	typ, data, err := s.readObject(hash)
+	if err != nil {
+		return err
+	}
+	if typ != "tree" {
+		return fmt.Errorf("%s is a %s, not a tree", hash, typ)
+	}
+	// Entries are "<octal mode> <name>\x00<20 byte hash>"
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp < 0 || nul < sp || len(data) < nul+21 {
+			return fmt.Errorf("malformed tree %s", hash)
+		}
+		mode, err := strconv.ParseUint(string(data[:sp]), 8, 32)
+		if err != nil {
+			return err
+		}
+		name := prefix + string(data[sp+1:nul])
+		entryHash := hex.EncodeToString(data[nul+1 : nul+21])
+		data = data[nul+21:]
+
+		if mode == 0040000 {
+			if err := s.readTreeRecursive(entryHash, name+"/", out); err != nil {
+				return err
+			}
+			continue
+		}
+		out[name] = treeEntry{mode: uint32(mode), hash: entryHash}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package gitstatus
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Operation describes an in-progress git operation such as a rebase
+type Operation struct {
+	Name  string
+	Step  int
+	Total int
+}
+
+// String formats the operation like git's own prompt, ex: "REBASE-i 2/5"
+func (o Operation) String() string {
+	if o.Total == 0 {
+		return o.Name
+	}
+	return fmt.Sprintf("%s %d/%d", o.Name, o.Step, o.Total)
+}
+
+// readOperation detects an in-progress operation from the files git
+// leaves in gitDir. The checks follow the order used by git-prompt.sh.
+func readOperation(gitDir string) Operation {
+	var op Operation
+	if dir := filepath.Join(gitDir, "rebase-merge"); isDir(dir) {
+		op.Name = "REBASE-m"
+		if exists(filepath.Join(dir, "interactive")) {
+			op.Name = "REBASE-i"
+		}
+		op.Step = readInt(filepath.Join(dir, "msgnum"))
+		op.Total = readInt(filepath.Join(dir, "end"))
+		return op
+	}
+	if dir := filepath.Join(gitDir, "rebase-apply"); isDir(dir) {
+		switch {
+		case exists(filepath.Join(dir, "rebasing")):
+			op.Name = "REBASE"
+		case exists(filepath.Join(dir, "applying")):
+			op.Name = "AM"
+		default:
+			op.Name = "AM/REBASE"
+		}
+		op.Step = readInt(filepath.Join(dir, "next"))
+		op.Total = readInt(filepath.Join(dir, "last"))
+		return op
+	}
+	switch {
+	case exists(filepath.Join(gitDir, "MERGE_HEAD")):
+		op.Name = "MERGING"
+	case exists(filepath.Join(gitDir, "CHERRY_PICK_HEAD")):
+		op.Name = "CHERRY-PICKING"
+	case exists(filepath.Join(gitDir, "REVERT_HEAD")):
+		op.Name = "REVERTING"
+	case exists(filepath.Join(gitDir, "BISECT_LOG")):
+		op.Name = "BISECTING"
+	}
+	return op
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// readInt returns the integer contents of file, or 0 if it can't be read
+func readInt(path string) int {
+	b, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return 0
+	}
+	i, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return i
+}
@@ -0,0 +1,63 @@
+package gitstatus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOperation(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{"none", nil, ""},
+		{"merge", map[string]string{"MERGE_HEAD": "abc"}, "MERGING"},
+		{"cherry-pick", map[string]string{"CHERRY_PICK_HEAD": "abc"}, "CHERRY-PICKING"},
+		{"revert", map[string]string{"REVERT_HEAD": "abc"}, "REVERTING"},
+		{"bisect", map[string]string{"BISECT_LOG": ""}, "BISECTING"},
+		{"rebase-i", map[string]string{
+			"rebase-merge/interactive": "",
+			"rebase-merge/msgnum":      "2\n",
+			"rebase-merge/end":         "5\n",
+		}, "REBASE-i 2/5"},
+		{"rebase-m", map[string]string{
+			"rebase-merge/msgnum": "1",
+			"rebase-merge/end":    "3",
+		}, "REBASE-m 1/3"},
+		{"rebase-apply", map[string]string{
+			"rebase-apply/rebasing": "",
+			"rebase-apply/next":     "4",
+			"rebase-apply/last":     "4",
+		}, "REBASE 4/4"},
+		{"am", map[string]string{
+			"rebase-apply/applying": "",
+			"rebase-apply/next":     "1",
+			"rebase-apply/last":     "2",
+		}, "AM 1/2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gitprompt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if out := readOperation(dir).String(); out != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package gitstatus
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func consumeNext(s *bufio.Scanner) string {
+	if s.Scan() {
+		return s.Text()
+	}
+	return ""
+}
+
+// scanNul is a bufio.SplitFunc for the NUL-terminated records of `git status -z`
+func scanNul(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	// Final record may be unterminated if git was killed
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Parse begins parsing data returned from `git status --porcelain=v2 -z`.
+// Parsing continues past a malformed record; the first error is returned.
+func (st *Status) Parse(r io.Reader) (err error) {
+	var s = bufio.NewScanner(r)
+	s.Split(scanNul)
+
+	for s.Scan() {
+		var e error
+		switch rec := s.Text(); {
+		case rec == "":
+			continue
+		case strings.HasPrefix(rec, "2 "):
+			// Original path of a rename or copy is the next record
+			e = st.parseRenamedFile(rec, consumeNext(s))
+		default:
+			e = st.ParseRecord(rec)
+		}
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// ParseRecord parses a single record of `git status --porcelain=v2 -z` output.
+// A rename or copy record parsed alone will have an empty OrigPath.
+func (st *Status) ParseRecord(line string) (err error) {
+	s := bufio.NewScanner(strings.NewReader(line))
+	// switch to a word based scanner
+	s.Split(bufio.ScanWords)
+
+	if !s.Scan() {
+		return nil
+	}
+	switch s.Text() {
+	case "#":
+		err = st.parseBranchInfo(s)
+	case "1":
+		err = st.parseTrackedFile(line)
+	case "2":
+		err = st.parseRenamedFile(line, "")
+	case "u":
+		err = st.parseUnmergedFile(line)
+	case "?":
+		st.Untracked++
+		st.Files = append(st.Files, FileStatus{XY: "??", Path: line[2:]})
+	case "!":
+		st.Files = append(st.Files, FileStatus{XY: "!!", Path: line[2:]})
+	}
+	return err
+}
+
+func (st *Status) parseBranchInfo(s *bufio.Scanner) (err error) {
+	// uses the word based scanner from ParseRecord
+	for s.Scan() {
+		switch s.Text() {
+		case "branch.oid":
+			st.Commit = consumeNext(s)
+		case "branch.head":
+			st.Branch = consumeNext(s)
+		case "branch.upstream":
+			st.Upstream = consumeNext(s)
+		case "branch.ab":
+			err = st.parseAheadBehind(s)
+		}
+	}
+	return err
+}
+
+func (st *Status) parseDiffNumstat(s string) error {
+	// Get total count of added/deleted lines
+	lines := strings.Split(s, "\n")
+	for _, line := range lines {
+		stats := strings.Split(line, "\t")
+		ins, err := strconv.Atoi(stats[0])
+		if err != nil {
+			return err
+		}
+		st.Insertions += ins
+
+		del, err := strconv.Atoi(stats[1])
+		if err != nil {
+			return err
+		}
+		st.Deletions += del
+	}
+	return nil
+}
+
+func (st *Status) parseAheadBehind(s *bufio.Scanner) error {
+	// uses the word based scanner from ParseRecord
+	for s.Scan() {
+		i, err := strconv.Atoi(s.Text()[1:])
+		if err != nil {
+			return err
+		}
+
+		switch s.Text()[:1] {
+		case "+":
+			st.Ahead = i
+		case "-":
+			st.Behind = i
+		}
+	}
+	return nil
+}
+
+// parseTrackedFile parses the porcelain v2 output for tracked entries
+// doc: https://git-scm.com/docs/git-status#_changed_tracked_entries
+func (st *Status) parseTrackedFile(line string) error {
+	// 1 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <path>
+	fields := strings.SplitN(line, " ", 9)
+	if len(fields) < 9 || len(fields[1]) != 2 {
+		return fmt.Errorf("malformed tracked entry: %q", line)
+	}
+	st.addFile(FileStatus{
+		XY:           fields[1],
+		Sub:          fields[2],
+		ModeHead:     fields[3],
+		ModeIndex:    fields[4],
+		ModeWorktree: fields[5],
+		HashHead:     fields[6],
+		HashIndex:    fields[7],
+		Path:         fields[8],
+	})
+	return nil
+}
+
+// parseRenamedFile parses the porcelain v2 output for renamed or copied entries
+func (st *Status) parseRenamedFile(line, origPath string) error {
+	// 2 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <X><score> <path>
+	fields := strings.SplitN(line, " ", 10)
+	if len(fields) < 10 || len(fields[1]) != 2 || len(fields[8]) < 2 {
+		return fmt.Errorf("malformed renamed entry: %q", line)
+	}
+	score, err := strconv.Atoi(fields[8][1:])
+	if err != nil {
+		return err
+	}
+	st.addFile(FileStatus{
+		XY:           fields[1],
+		Sub:          fields[2],
+		ModeHead:     fields[3],
+		ModeIndex:    fields[4],
+		ModeWorktree: fields[5],
+		HashHead:     fields[6],
+		HashIndex:    fields[7],
+		Score:        score,
+		Path:         fields[9],
+		OrigPath:     origPath,
+	})
+	return nil
+}
+
+// parseUnmergedFile parses the porcelain v2 output for unmerged entries
+func (st *Status) parseUnmergedFile(line string) error {
+	// u <XY> <sub> <m1> <m2> <m3> <mW> <h1> <h2> <h3> <path>
+	fields := strings.SplitN(line, " ", 11)
+	if len(fields) < 11 {
+		return fmt.Errorf("malformed unmerged entry: %q", line)
+	}
+	st.Unmerged++
+	st.Conflicts.parseConflict(fields[1])
+	st.Files = append(st.Files, FileStatus{
+		XY:           fields[1],
+		Sub:          fields[2],
+		ModeWorktree: fields[6],
+		Path:         fields[10],
+	})
+	return nil
+}
+
+// addFile records a changed tracked file and updates the
+// Staged and Unstaged counts from its xy status code
+func (st *Status) addFile(f FileStatus) {
+	st.Staged.parseModified(f.XY[:1])
+	st.Unstaged.parseModified(f.XY[1:])
+	st.Submodules.parseSubmodule(f.Sub)
+	st.Files = append(st.Files, f)
+}
+
+// parseModified parses the xy status code from porcelain v2
+// and assigns it to the Staged or Unstaged GitArea vars
+func (ga *GitArea) parseModified(c string) error {
+	switch c {
+	case "M":
+		ga.Modified++
+	case "A":
+		ga.Added++
+	case "D":
+		ga.Deleted++
+	case "R":
+		ga.Renamed++
+	case "C":
+		ga.Copied++
+	}
+	return nil
+}
+
+// parseConflict parses the xy status code of an unmerged entry
+// doc: https://git-scm.com/docs/git-status#_short_format
+func (c *Conflicts) parseConflict(xy string) {
+	switch xy {
+	case "DD":
+		c.BothDeleted++
+	case "AU":
+		c.AddedByUs++
+	case "UD":
+		c.DeletedByThem++
+	case "UA":
+		c.AddedByThem++
+	case "DU":
+		c.DeletedByUs++
+	case "AA":
+		c.BothAdded++
+	case "UU":
+		c.BothModified++
+	}
+}
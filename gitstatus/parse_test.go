@@ -0,0 +1,160 @@
+package gitstatus
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gitoutput is converted to the NUL-delimited form of `git status -z`
+var gitoutput = strings.NewReplacer("\n", "\x00", "\t", "\x00").Replace(`
+# branch.oid 51c9c58e2175b768137c1e38865f394c76a7d49d
+# branch.head master
+# branch.upstream origin/master
+# branch.ab +1 -10
+1 .M N... 100644 100644 100644 3e2ceb914cf9be46bf235432781840f4145363fd 3e2ceb914cf9be46bf235432781840f4145363fd Gopkg.lock
+1 .M N... 100644 100644 100644 cecb683e6e626bcba909ddd36d3357d49f0cfd09 cecb683e6e626bcba909ddd36d3357d49f0cfd09 Gopkg.toml
+1 .M N... 100644 100644 100644 aea984b7df090ce3a5826a854f3e5364cd8f2ccd aea984b7df090ce3a5826a854f3e5364cd8f2ccd porcelain.go
+1 .D N... 100644 100644 000000 6d9532ba55b84ec4faf214f9cdb9ce70ec8f4f5b 6d9532ba55b84ec4faf214f9cdb9ce70ec8f4f5b porcelain_test.go
+2 R. N... 100644 100644 100644 44d0a25072ee3706a8015bef72bdd2c4ab6da76d 44d0a25072ee3706a8015bef72bdd2c4ab6da76d R100 hm.rb	hw.rb
+u UU N... 100644 100644 100644 100644 ac51efdc3df4f4fd328d1a02ad05331d8e2c9111 36c06c8752c78d2aff89571132f3bf7841a7b5c3 e85207e04dfdd5eb0a1e9febbc67fd837c44a1cd hw.rb
+? _porcelain_test.go
+? git.go
+? git_test.go
+? goreleaser.yml
+? vendor/
+`)
+
+var expectedStatus = Status{
+	Branch:    "master",
+	Commit:    "51c9c58e2175b768137c1e38865f394c76a7d49d",
+	Remote:    "",
+	Upstream:  "origin/master",
+	Ahead:     1,
+	Behind:    10,
+	Untracked: 5,
+	Unmerged:  1,
+	Files: []FileStatus{
+		{XY: ".M", Sub: "N...", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "100644",
+			HashHead: "3e2ceb914cf9be46bf235432781840f4145363fd", HashIndex: "3e2ceb914cf9be46bf235432781840f4145363fd",
+			Path: "Gopkg.lock"},
+		{XY: ".M", Sub: "N...", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "100644",
+			HashHead: "cecb683e6e626bcba909ddd36d3357d49f0cfd09", HashIndex: "cecb683e6e626bcba909ddd36d3357d49f0cfd09",
+			Path: "Gopkg.toml"},
+		{XY: ".M", Sub: "N...", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "100644",
+			HashHead: "aea984b7df090ce3a5826a854f3e5364cd8f2ccd", HashIndex: "aea984b7df090ce3a5826a854f3e5364cd8f2ccd",
+			Path: "porcelain.go"},
+		{XY: ".D", Sub: "N...", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "000000",
+			HashHead: "6d9532ba55b84ec4faf214f9cdb9ce70ec8f4f5b", HashIndex: "6d9532ba55b84ec4faf214f9cdb9ce70ec8f4f5b",
+			Path: "porcelain_test.go"},
+		{XY: "R.", Sub: "N...", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "100644",
+			HashHead: "44d0a25072ee3706a8015bef72bdd2c4ab6da76d", HashIndex: "44d0a25072ee3706a8015bef72bdd2c4ab6da76d",
+			Score: 100, Path: "hm.rb", OrigPath: "hw.rb"},
+		{XY: "UU", Sub: "N...", ModeWorktree: "100644", Path: "hw.rb"},
+		{XY: "??", Path: "_porcelain_test.go"},
+		{XY: "??", Path: "git.go"},
+		{XY: "??", Path: "git_test.go"},
+		{XY: "??", Path: "goreleaser.yml"},
+		{XY: "??", Path: "vendor/"},
+	},
+	Unstaged: GitArea{
+		Modified: 3,
+		Added:    0,
+		Deleted:  1,
+		Renamed:  0,
+		Copied:   0,
+	},
+	Staged: GitArea{
+		Modified: 0,
+		Added:    0,
+		Deleted:  0,
+		Renamed:  1,
+		Copied:   0,
+	},
+	Conflicts: Conflicts{
+		BothModified: 1,
+	},
+}
+
+func TestParse(t *testing.T) {
+	var st = new(Status)
+	if err := st.Parse(strings.NewReader(gitoutput)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&expectedStatus, st) {
+		t.Logf("%#+v\n", st)
+		t.FailNow()
+	}
+}
+
+func TestParseUnusualPaths(t *testing.T) {
+	const out = "1 .M N... 100644 100644 100644 3e2ceb914cf9be46bf235432781840f4145363fd " +
+		"3e2ceb914cf9be46bf235432781840f4145363fd with \"quote\" and\ttab.txt\x00" +
+		"2 R. N... 100644 100644 100644 44d0a25072ee3706a8015bef72bdd2c4ab6da76d " +
+		"44d0a25072ee3706a8015bef72bdd2c4ab6da76d R87 new name.rb\x00old\nname.rb\x00" +
+		"? 1 leading digit\x00"
+	var st = new(Status)
+	if err := st.Parse(strings.NewReader(out)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []FileStatus{
+		{XY: ".M", Sub: "N...", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "100644",
+			HashHead: "3e2ceb914cf9be46bf235432781840f4145363fd", HashIndex: "3e2ceb914cf9be46bf235432781840f4145363fd",
+			Path: "with \"quote\" and\ttab.txt"},
+		{XY: "R.", Sub: "N...", ModeHead: "100644", ModeIndex: "100644", ModeWorktree: "100644",
+			HashHead: "44d0a25072ee3706a8015bef72bdd2c4ab6da76d", HashIndex: "44d0a25072ee3706a8015bef72bdd2c4ab6da76d",
+			Score: 87, Path: "new name.rb", OrigPath: "old\nname.rb"},
+		{XY: "??", Path: "1 leading digit"},
+	}
+	if !reflect.DeepEqual(expected, st.Files) {
+		t.Errorf("expected:\n%#+v\ngot:\n%#+v", expected, st.Files)
+	}
+	if st.Untracked != 1 || st.Staged.Renamed != 1 || st.Unstaged.Modified != 1 {
+		t.Errorf("unexpected counts: %s", st.Debug(false))
+	}
+}
+
+func TestParseConflicts(t *testing.T) {
+	var out string
+	for _, xy := range []string{"DD", "AU", "UD", "UA", "DU", "AA", "UU", "UU"} {
+		out += "u " + xy + " N... 100644 100644 100644 100644 " +
+			"ac51efdc3df4f4fd328d1a02ad05331d8e2c9111 36c06c8752c78d2aff89571132f3bf7841a7b5c3 " +
+			"e85207e04dfdd5eb0a1e9febbc67fd837c44a1cd file" + xy + "\x00"
+	}
+	var st = new(Status)
+	if err := st.Parse(strings.NewReader(out)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Conflicts{1, 1, 1, 1, 1, 1, 2}
+	if st.Conflicts != expected {
+		t.Errorf("expected %#+v, got %#+v", expected, st.Conflicts)
+	}
+	if st.Unmerged != 8 || st.Conflicts.Count() != 8 {
+		t.Errorf("expected 8 unmerged, got %d", st.Unmerged)
+	}
+	if s := st.Conflicts.String(); s != "DD1 AU1 UD1 UA1 DU1 AA1 UU2" {
+		t.Errorf("unexpected conflict string %q", s)
+	}
+}
+
+func TestParseSubmodules(t *testing.T) {
+	var out string
+	for _, sub := range []string{"N...", "SC..", "S.M.", "SCMU", "S..U"} {
+		out += "1 .M " + sub + " 160000 160000 160000 " +
+			"3e2ceb914cf9be46bf235432781840f4145363fd 3e2ceb914cf9be46bf235432781840f4145363fd path\x00"
+	}
+	var st = new(Status)
+	if err := st.Parse(strings.NewReader(out)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Submodules{NewCommits: 2, Modified: 2, Untracked: 2}
+	if st.Submodules != expected {
+		t.Errorf("expected %#+v, got %#+v", expected, st.Submodules)
+	}
+	if s := st.Submodules.String(); s != "C2M2U2" {
+		t.Errorf("unexpected submodule string %q", s)
+	}
+}
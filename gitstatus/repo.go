@@ -0,0 +1,449 @@
+package gitstatus
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Repo reads HEAD, refs, config and reflogs directly from a git
+// directory so they can be used without running git. A Repo is safe
+// for concurrent use.
+type Repo struct {
+	GitDir    string // per-worktree dir holding HEAD and index
+	CommonDir string // shared dir holding refs, packed-refs and config
+	WorkTree  string // top level of the work tree
+
+	mu     sync.Mutex // guards packed and config as they are loaded
+	packed map[string]packedRef
+	config map[string]string
+}
+
+// packedRef is a single entry of packed-refs
+type packedRef struct {
+	hash   string
+	peeled string // commit an annotated tag points to, if known
+}
+
+// OpenRepo finds the git directory for dir by walking up the tree
+// looking for `.git`, the same way git does without GIT_DIR set
+func OpenRepo(dir string) (*Repo, error) {
+	if env := os.Getenv("GIT_DIR"); env != "" {
+		return newRepo(env, os.Getenv("GIT_WORK_TREE"))
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if fi, err := os.Stat(dotGit); err == nil {
+			if fi.IsDir() {
+				return newRepo(dotGit, dir)
+			}
+			// Worktrees and submodules use a file pointing to the real dir
+			if gitDir, err := readGitFile(dotGit); err == nil {
+				return newRepo(gitDir, dir)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotAGitRepo
+		}
+		dir = parent
+	}
+}
+
+func newRepo(gitDir, workTree string) (*Repo, error) {
+	gitDir, err := filepath.Abs(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	if !exists(filepath.Join(gitDir, "HEAD")) {
+		return nil, ErrNotAGitRepo
+	}
+	r := &Repo{GitDir: gitDir, CommonDir: gitDir, WorkTree: workTree}
+	if b, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil { // #nosec
+		common := strings.TrimSpace(string(b))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+		r.CommonDir = filepath.Clean(common)
+	}
+	return r, nil
+}
+
+// openSubmodule opens the submodule checked out at dir, whose .git is
+// either its git dir or a file pointing to it
+func openSubmodule(dir string) (*Repo, error) {
+	dotGit := filepath.Join(dir, ".git")
+	if isDir(dotGit) {
+		return newRepo(dotGit, dir)
+	}
+	gitDir, err := readGitFile(dotGit)
+	if err != nil {
+		return nil, err
+	}
+	return newRepo(gitDir, dir)
+}
+
+// SubmoduleGitDirs returns the git dir of each submodule in .gitmodules
+// that is checked out, and those of their own submodules
+func (r *Repo) SubmoduleGitDirs() []string {
+	modules, _ := readConfig(filepath.Join(r.WorkTree, ".gitmodules"))
+	var dirs []string
+	for key, p := range modules {
+		if !strings.HasPrefix(key, "submodule.") || !strings.HasSuffix(key, ".path") {
+			continue
+		}
+		sub, err := openSubmodule(filepath.Join(r.WorkTree, filepath.FromSlash(p)))
+		if err != nil {
+			continue
+		}
+		dirs = append(dirs, sub.GitDir)
+		dirs = append(dirs, sub.SubmoduleGitDirs()...)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// readGitFile returns the dir from a `gitdir: <path>` file
+func readGitFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(line, "gitdir: ") {
+		return "", ErrNotAGitRepo
+	}
+	gitDir := strings.TrimPrefix(line, "gitdir: ")
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+	return filepath.Clean(gitDir), nil
+}
+
+// Head returns the short branch name and commit of HEAD in the same form
+// as the porcelain v2 `# branch` headers: branch is "(detached)" if HEAD
+// is not a branch, and commit is "(initial)" if the branch has no commits
+func (r *Repo) Head() (branch, commit string, err error) {
+	b, err := ioutil.ReadFile(filepath.Join(r.GitDir, "HEAD")) // #nosec
+	if err != nil {
+		return "", "", err
+	}
+	head := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(head, "ref: ") {
+		return "(detached)", head, nil
+	}
+	ref := strings.TrimPrefix(head, "ref: ")
+	branch = strings.TrimPrefix(ref, "refs/heads/")
+	if commit, err = r.ResolveRef(ref); err != nil {
+		if os.IsNotExist(err) {
+			return branch, "(initial)", nil
+		}
+		return "", "", err
+	}
+	return branch, commit, nil
+}
+
+// ResolveRef returns the hash a full ref name points to, following
+// symbolic refs. Loose refs take precedence over packed-refs.
+func (r *Repo) ResolveRef(name string) (string, error) {
+	for i := 0; i < 5; i++ {
+		b, err := ioutil.ReadFile(r.refPath(name)) // #nosec
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+			packed, err := r.packedRefs()
+			if err != nil {
+				return "", err
+			}
+			if p, ok := packed[name]; ok {
+				return p.hash, nil
+			}
+			return "", os.ErrNotExist
+		}
+		ref := strings.TrimSpace(string(b))
+		if !strings.HasPrefix(ref, "ref: ") {
+			return ref, nil
+		}
+		name = strings.TrimPrefix(ref, "ref: ")
+	}
+	return "", os.ErrNotExist
+}
+
+// refPath returns the file for a loose ref; HEAD-like refs live in the
+// worktree's own dir while everything under refs/ is shared
+func (r *Repo) refPath(name string) string {
+	if strings.HasPrefix(name, "refs/") {
+		return filepath.Join(r.CommonDir, filepath.FromSlash(name))
+	}
+	return filepath.Join(r.GitDir, name)
+}
+
+// packedRefs parses and caches packed-refs
+func (r *Repo) packedRefs() (map[string]packedRef, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.packed != nil {
+		return r.packed, nil
+	}
+	r.packed = make(map[string]packedRef)
+	f, err := os.Open(filepath.Join(r.CommonDir, "packed-refs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r.packed, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var last string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case line == "" || line[0] == '#':
+			continue
+		case line[0] == '^':
+			// Peeled value of the preceding annotated tag
+			if p, ok := r.packed[last]; ok {
+				p.peeled = line[1:]
+				r.packed[last] = p
+			}
+		default:
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) == 2 {
+				last = fields[1]
+				r.packed[last] = packedRef{hash: fields[0]}
+			}
+		}
+	}
+	return r.packed, s.Err()
+}
+
+// Upstream returns the remote and upstream branch (ex: "origin",
+// "origin/master") configured for branch, or empty strings if none
+func (r *Repo) Upstream(branch string) (remote, upstream string, err error) {
+	config, err := r.Config()
+	if err != nil {
+		return "", "", err
+	}
+	remote = config["branch."+branch+".remote"]
+	merge := config["branch."+branch+".merge"]
+	if remote == "" || merge == "" {
+		return "", "", nil
+	}
+	merge = strings.TrimPrefix(merge, "refs/heads/")
+	if remote == "." {
+		return remote, merge, nil
+	}
+	return remote, remote + "/" + merge, nil
+}
+
+// Config returns the repo's config file as a map of "section.key" or
+// "section.subsection.key" names to values. Section and key names are
+// lowercased as git treats them case-insensitively; subsections are not.
+// Includes are not followed.
+func (r *Repo) Config() (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.config != nil {
+		return r.config, nil
+	}
+	config, err := readConfig(filepath.Join(r.CommonDir, "config"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	r.config = config
+	return r.config, nil
+}
+
+// configValue returns key from the repo config, or if it is not set
+// there, from the user and system config the way git reads them
+func (r *Repo) configValue(key string) string {
+	config, _ := r.Config()
+	if v, ok := config[key]; ok {
+		return v
+	}
+	// Later files in git's order override earlier ones, so the first
+	// found here wins
+	var files []string
+	if home, xdg := userConfigDirs(); home != "" {
+		files = append(files, filepath.Join(home, ".gitconfig"), filepath.Join(xdg, "git", "config"))
+	}
+	if os.Getenv("GIT_CONFIG_NOSYSTEM") == "" {
+		files = append(files, "/etc/gitconfig")
+	}
+	for _, file := range files {
+		global, _ := readConfig(file)
+		if v, ok := global[key]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// userConfigDirs returns the home dir and $XDG_CONFIG_HOME, which
+// defaults to ~/.config, or "" for both if there is no home dir
+func userConfigDirs() (home, xdg string) {
+	home, _ = os.UserHomeDir()
+	if home == "" {
+		return "", ""
+	}
+	xdg = os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	return home, xdg
+}
+
+// readConfig parses a git config file; see git-config(1)
+func readConfig(path string) (map[string]string, error) {
+	config := make(map[string]string)
+	f, err := os.Open(path) // #nosec
+	if err != nil {
+		return config, err
+	}
+	defer f.Close()
+
+	var section string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			section = parseConfigSection(line)
+			continue
+		}
+		key, value := line, "true"
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			key, value = strings.TrimSpace(line[:i]), parseConfigValue(line[i+1:])
+		}
+		config[section+"."+strings.ToLower(key)] = value
+	}
+	return config, s.Err()
+}
+
+// parseConfigSection parses `[section "subsection"]` or `[section.subsection]`
+func parseConfigSection(line string) string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+	if i := strings.IndexByte(line, '"'); i >= 0 {
+		sub := strings.TrimSuffix(line[i+1:], `"`)
+		sub = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(sub)
+		return strings.ToLower(strings.TrimSpace(line[:i])) + "." + sub
+	}
+	return strings.ToLower(line)
+}
+
+// parseConfigValue strips quotes, escapes and trailing comments from a value
+func parseConfigValue(v string) string {
+	var out strings.Builder
+	var quoted bool
+	v = strings.TrimSpace(v)
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && i+1 < len(v):
+			i++
+			switch v[i] {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			default:
+				out.WriteByte(v[i])
+			}
+		case (c == '#' || c == ';') && !quoted:
+			return strings.TrimSpace(out.String())
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// TagForCommit returns the name of a tag pointing at commit, similar to
+// `git describe --tags --exact-match`, or an empty string if none does
+func (r *Repo) TagForCommit(commit string) (string, error) {
+	var tags []string
+	objects := newObjectStore(filepath.Join(r.CommonDir, "objects"))
+	tagDir := filepath.Join(r.CommonDir, "refs", "tags")
+	err := filepath.Walk(tagDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return nil
+		}
+		b, err := ioutil.ReadFile(path) // #nosec
+		if err != nil {
+			return nil
+		}
+		if peelTag(objects, strings.TrimSpace(string(b))) == commit {
+			name, _ := filepath.Rel(tagDir, path)
+			tags = append(tags, filepath.ToSlash(name))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	packed, err := r.packedRefs()
+	if err != nil {
+		return "", err
+	}
+	for name, p := range packed {
+		if !strings.HasPrefix(name, "refs/tags/") {
+			continue
+		}
+		// Older git does not record the peeled commit of every tag
+		if p.hash == commit || p.peeled == commit || p.peeled == "" && peelTag(objects, p.hash) == commit {
+			tags = append(tags, strings.TrimPrefix(name, "refs/tags/"))
+		}
+	}
+	if len(tags) == 0 {
+		return "", nil
+	}
+	sort.Strings(tags)
+	return tags[0], nil
+}
+
+// peelTag returns the object an annotated tag points to, following
+// tags of tags, or hash itself if it is not a tag object. Tag objects
+// may be loose or packed.
+func peelTag(objects *objectStore, hash string) string {
+	for depth := 0; depth < 10; depth++ {
+		typ, data, err := objects.readObject(hash)
+		if err != nil || typ != "tag" {
+			return hash
+		}
+		line := strings.SplitN(string(data), "\n", 2)[0]
+		if !strings.HasPrefix(line, "object ") {
+			return hash
+		}
+		hash = strings.TrimPrefix(line, "object ")
+	}
+	return hash
+}
+
+// StashCount returns the number of stash entries by counting
+// lines in the stash reflog
+func (r *Repo) StashCount() (int, error) {
+	b, err := ioutil.ReadFile(filepath.Join(r.CommonDir, "logs", "refs", "stash"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return bytes.Count(b, []byte("\n")), nil
+}
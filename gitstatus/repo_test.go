@@ -0,0 +1,166 @@
+package gitstatus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	masterHash = "51c9c58e2175b768137c1e38865f394c76a7d49d"
+	otherHash  = "44d0a25072ee3706a8015bef72bdd2c4ab6da76d"
+	tagHash    = "6d9532ba55b84ec4faf214f9cdb9ce70ec8f4f5b"
+)
+
+// writeFiles creates each file under dir with the given contents
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newFixtureRepo(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gitprompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{
+		".git/HEAD":              "ref: refs/heads/master\n",
+		".git/refs/heads/master": masterHash + "\n",
+		".git/packed-refs": "# pack-refs with: peeled fully-peeled sorted\n" +
+			otherHash + " refs/heads/feature\n" +
+			tagHash + " refs/tags/v1.0\n" +
+			"^" + masterHash + "\n" +
+			otherHash + " refs/tags/v0.9\n",
+		".git/config": "[core]\n\tbare = false\n" +
+			"[remote \"origin\"]\n\turl = git@example.com:repo.git\n" +
+			"[branch \"master\"]\n\tremote = origin\n\tmerge = refs/heads/master\n" +
+			"[branch \"feature\"]\n\tremote = .\n\tmerge = refs/heads/master ; local\n",
+		".git/logs/refs/stash": "a b c\nd e f\n",
+		"sub/dir/file.txt":     "",
+	})
+	return dir
+}
+
+func TestRepoHead(t *testing.T) {
+	dir := newFixtureRepo(t)
+	defer os.RemoveAll(dir)
+
+	repo, err := OpenRepo(filepath.Join(dir, "sub", "dir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch, commit, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch != "master" || commit != masterHash {
+		t.Errorf("unexpected head: %s %s", branch, commit)
+	}
+
+	if hash, err := repo.ResolveRef("refs/heads/feature"); err != nil || hash != otherHash {
+		t.Errorf("unexpected packed ref: %s %v", hash, err)
+	}
+
+	writeFiles(t, dir, map[string]string{".git/HEAD": otherHash + "\n"})
+	if branch, commit, _ = repo.Head(); branch != "(detached)" || commit != otherHash {
+		t.Errorf("unexpected detached head: %s %s", branch, commit)
+	}
+
+	writeFiles(t, dir, map[string]string{".git/HEAD": "ref: refs/heads/unborn\n"})
+	if branch, commit, _ = repo.Head(); branch != "unborn" || commit != "(initial)" {
+		t.Errorf("unexpected unborn head: %s %s", branch, commit)
+	}
+}
+
+func TestRepoUpstream(t *testing.T) {
+	dir := newFixtureRepo(t)
+	defer os.RemoveAll(dir)
+
+	repo, err := OpenRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		branch, remote, upstream string
+	}{
+		{"master", "origin", "origin/master"},
+		{"feature", ".", "master"},
+		{"none", "", ""},
+	}
+	for _, tt := range tests {
+		remote, upstream, err := repo.Upstream(tt.branch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if remote != tt.remote || upstream != tt.upstream {
+			t.Errorf("%s: expected %s %s, got %s %s", tt.branch, tt.remote, tt.upstream, remote, upstream)
+		}
+	}
+}
+
+func TestRepoTagAndStash(t *testing.T) {
+	dir := newFixtureRepo(t)
+	defer os.RemoveAll(dir)
+
+	repo, err := OpenRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag, err := repo.TagForCommit(masterHash); err != nil || tag != "v1.0" {
+		t.Errorf("expected peeled tag v1.0, got %q %v", tag, err)
+	}
+	if tag, _ := repo.TagForCommit(otherHash); tag != "v0.9" {
+		t.Errorf("expected tag v0.9, got %q", tag)
+	}
+	if tag, _ := repo.TagForCommit(tagHash + "0"); tag != "" {
+		t.Errorf("expected no tag, got %q", tag)
+	}
+	if n, err := repo.StashCount(); err != nil || n != 2 {
+		t.Errorf("expected 2 stashes, got %d %v", n, err)
+	}
+}
+
+func TestOpenRepoWorktree(t *testing.T) {
+	dir := newFixtureRepo(t)
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		"wt/.git":                     "gitdir: ../.git/worktrees/wt\n",
+		".git/worktrees/wt/HEAD":      "ref: refs/heads/feature\n",
+		".git/worktrees/wt/commondir": "../..\n",
+	})
+	repo, err := OpenRepo(filepath.Join(dir, "wt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.CommonDir != filepath.Join(dir, ".git") {
+		t.Errorf("unexpected common dir %s", repo.CommonDir)
+	}
+	if branch, commit, _ := repo.Head(); branch != "feature" || commit != otherHash {
+		t.Errorf("unexpected worktree head: %s %s", branch, commit)
+	}
+}
+
+func TestParseConfigValue(t *testing.T) {
+	tests := []struct {
+		in, expected string
+	}{
+		{" plain ", "plain"},
+		{`"quoted ; value" # comment`, "quoted ; value"},
+		{`a\tb\\c`, "a\tb\\c"},
+		{"value ; comment", "value"},
+	}
+	for _, tt := range tests {
+		if out := parseConfigValue(tt.in); out != tt.expected {
+			t.Errorf("parseConfigValue(%q): expected %q, got %q", tt.in, tt.expected, out)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Package gitstatus parses `git status --porcelain=v2` output and
+// collects related repository state for use in shell prompts.
+package gitstatus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GitArea holds status info
+type GitArea struct {
+	Modified int `json:"modified"`
+	Added    int `json:"added"`
+	Deleted  int `json:"deleted"`
+	Renamed  int `json:"renamed"`
+	Copied   int `json:"copied"`
+}
+
+// HasChanged reports whether any files in the area have changed
+func (a *GitArea) HasChanged() bool {
+	return a.Added+a.Deleted+a.Modified+a.Copied+a.Renamed != 0
+}
+
+// Count returns the total number of changed files in the area
+func (a *GitArea) Count() int {
+	return a.Added + a.Deleted + a.Modified + a.Copied + a.Renamed
+}
+
+// Conflicts holds counts of unmerged entries by conflict type
+type Conflicts struct {
+	BothDeleted   int `json:"both_deleted"`
+	AddedByUs     int `json:"added_by_us"`
+	DeletedByThem int `json:"deleted_by_them"`
+	AddedByThem   int `json:"added_by_them"`
+	DeletedByUs   int `json:"deleted_by_us"`
+	BothAdded     int `json:"both_added"`
+	BothModified  int `json:"both_modified"`
+}
+
+// Count returns the total number of unmerged entries
+func (c *Conflicts) Count() int {
+	return c.BothDeleted + c.AddedByUs + c.DeletedByThem + c.AddedByThem +
+		c.DeletedByUs + c.BothAdded + c.BothModified
+}
+
+// String formats non-zero conflict counts by xy code, ex: "UU2 DU1"
+func (c Conflicts) String() string {
+	var out []string
+	for _, t := range []struct {
+		xy string
+		n  int
+	}{
+		{"DD", c.BothDeleted},
+		{"AU", c.AddedByUs},
+		{"UD", c.DeletedByThem},
+		{"UA", c.AddedByThem},
+		{"DU", c.DeletedByUs},
+		{"AA", c.BothAdded},
+		{"UU", c.BothModified},
+	} {
+		if t.n > 0 {
+			out = append(out, fmt.Sprintf("%s%d", t.xy, t.n))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// Status holds data about the repo
+type Status struct {
+	WorkingDir      string
+	GitDir          string
+	Branch          string
+	Commit          string
+	Remote          string
+	Upstream        string
+	Stashes         int
+	Ahead           int
+	Behind          int
+	Untracked       int
+	Unmerged        int
+	Insertions      int
+	Deletions       int
+	TimedOut        bool
+	Operation       Operation
+	Files           []FileStatus
+	Unstaged        GitArea
+	Staged          GitArea
+	Conflicts       Conflicts
+	Submodules      Submodules
+	SubmoduleStatus []SubmoduleStatus
+}
+
+// IsDirty reports whether the work tree or index has any changes
+func (st *Status) IsDirty() bool {
+	return st.Staged.HasChanged() || st.Unstaged.HasChanged() || st.Untracked > 0
+}
+
+// Debug prints repo info
+func (st *Status) Debug(pretty bool) string {
+	if !pretty {
+		return fmt.Sprintf("%+v", st)
+	}
+	return fmt.Sprintf(`
+Status
+========
+workingDir: %v
+gitDir:     %v
+branch:     %v
+commit:     %v
+remote:     %v
+upstream:   %v
+stashes:    %4d
+ahead:      %4d
+behind:     %4d
+untracked:  %4d
+unmerged:   %4d
+insertions: %4d
+deletions:  %4d
+timedOut:   %-v
+operation:  %v
+
+Unstaged
+--------
+modified:   %4d
+added:      %4d
+deleted:    %4d
+renamed:    %4d
+copied:     %4d
+
+Staged
+--------
+modified:   %4d
+added:      %4d
+deleted:    %4d
+renamed:    %4d
+copied:     %4d
+
+Conflicts
+--------
+both deleted:    %4d
+added by us:     %4d
+deleted by them: %4d
+added by them:   %4d
+deleted by us:   %4d
+both added:      %4d
+both modified:   %4d`, st.WorkingDir, st.GitDir, st.Branch, st.Commit, st.Remote, st.Upstream,
+		st.Stashes, st.Ahead, st.Behind, st.Untracked, st.Unmerged, st.Insertions, st.Deletions,
+		st.TimedOut, st.Operation, st.Unstaged.Modified, st.Unstaged.Added, st.Unstaged.Deleted,
+		st.Unstaged.Renamed, st.Unstaged.Copied, st.Staged.Modified, st.Staged.Added, st.Staged.Deleted,
+		st.Staged.Renamed, st.Staged.Copied, st.Conflicts.BothDeleted, st.Conflicts.AddedByUs,
+		st.Conflicts.DeletedByThem, st.Conflicts.AddedByThem, st.Conflicts.DeletedByUs,
+		st.Conflicts.BothAdded, st.Conflicts.BothModified)
+}
@@ -0,0 +1,113 @@
+package gitstatus
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// Submodules holds counts of changed submodules by kind of change.
+// A submodule may be counted in more than one field.
+type Submodules struct {
+	NewCommits int `json:"new_commits"`
+	Modified   int `json:"modified"`
+	Untracked  int `json:"untracked"`
+}
+
+// HasChanged reports whether any submodule has changes
+func (sm *Submodules) HasChanged() bool {
+	return sm.NewCommits+sm.Modified+sm.Untracked != 0
+}
+
+// parseSubmodule parses the <sub> field from porcelain v2,
+// which is "N..." for regular files or "S<c><m><u>" for submodules
+func (sm *Submodules) parseSubmodule(sub string) {
+	if len(sub) != 4 || sub[0] != 'S' {
+		return
+	}
+	if sub[1] == 'C' {
+		sm.NewCommits++
+	}
+	if sub[2] == 'M' {
+		sm.Modified++
+	}
+	if sub[3] == 'U' {
+		sm.Untracked++
+	}
+}
+
+// String formats non-zero counts with git's flag letters, ex: "C1M2"
+func (sm Submodules) String() string {
+	var out string
+	if sm.NewCommits > 0 {
+		out += fmt.Sprintf("C%d", sm.NewCommits)
+	}
+	if sm.Modified > 0 {
+		out += fmt.Sprintf("M%d", sm.Modified)
+	}
+	if sm.Untracked > 0 {
+		out += fmt.Sprintf("U%d", sm.Untracked)
+	}
+	return out
+}
+
+// SubmoduleStatus summarizes the state of a single submodule
+type SubmoduleStatus struct {
+	Path   string `json:"path"`
+	Branch string `json:"branch"`
+	Commit string `json:"commit"`
+	Dirty  bool   `json:"dirty"`
+}
+
+// lookupSubmodules runs git status in each submodule listed in
+// .gitmodules, as many at once as there are CPUs
+func (c *collector) lookupSubmodules(ctx context.Context) ([]SubmoduleStatus, error) {
+	// .gitmodules and the paths in it are relative to the top level
+	root, err := c.workTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := GetGitSubmodulePaths(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]SubmoduleStatus, len(paths))
+	ok := make([]bool, len(paths))
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for i, p := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, p string) {
+			defer func() { <-sem; wg.Done() }()
+			out, err := GetGitStatusOutput(ctx, filepath.Join(root, p))
+			if err != nil {
+				// Uninitialized submodules have no work tree to check
+				c.log.Printf("Git status error in submodule %s: %s", p, err)
+				return
+			}
+			var sub = new(Status)
+			if err := sub.Parse(out); err != nil {
+				c.log.Printf("Error parsing submodule %s: %s", p, err)
+			}
+			subs[i] = SubmoduleStatus{
+				Path:   p,
+				Branch: sub.Branch,
+				Commit: sub.Commit,
+				Dirty:  sub.IsDirty(),
+			}
+			ok[i] = true
+		}(i, p)
+	}
+	wg.Wait()
+
+	var out []SubmoduleStatus
+	for i := range subs {
+		if ok[i] {
+			out = append(out, subs[i])
+		}
+	}
+	return out, nil
+}
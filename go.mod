@@ -1,6 +1,7 @@
 module github.com/comfortablynick/gitprompt
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/fatih/color v1.7.0
 	github.com/jessevdk/go-flags v1.4.0
 	github.com/mattn/go-colorable v0.1.4 // indirect